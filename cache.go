@@ -2,8 +2,8 @@ package pomdb
 
 import (
 	"fmt"
-	"log"
 	"reflect"
+	"time"
 
 	"github.com/gertd/go-pluralize"
 	"github.com/iancoleman/strcase"
@@ -23,6 +23,7 @@ type IndexField struct {
 	CurrentValue  string
 	PreviousValue string
 	IndexType     IndexType
+	Encrypted     bool
 }
 
 type ModelCache struct {
@@ -31,6 +32,8 @@ type ModelCache struct {
 	CreatedAt   *reflect.Value
 	UpdatedAt   *reflect.Value
 	DeletedAt   *reflect.Value
+	ExpiresAt   *reflect.Value
+	Encrypted   []string
 	Collection  string
 	Reference   interface{}
 }
@@ -39,10 +42,7 @@ func NewModelCache(rv reflect.Value) *ModelCache {
 	mc := &ModelCache{}
 
 	// Get the collection name
-	mc.Collection = pluralize.NewClient().Plural(strcase.ToSnake(rv.Type().Name()))
-
-	// Log the original and final names
-	log.Printf("Collection: %s -> %s", rv.Type().Name(), mc.Collection)
+	mc.Collection = collectionName(rv.Type())
 
 	// Store a reference to the original struct
 	mc.Reference = reflect.New(rv.Type()).Interface()
@@ -81,9 +81,18 @@ func NewModelCache(rv reflect.Value) *ModelCache {
 		pmtag := fpntr.Tag.Get("pomdb")
 		jstag := fpntr.Tag.Get("json")
 
+		if tagContains(pmtag, []string{"ttl"}) && fpntr.Type == reflect.TypeOf(Timestamp{}) {
+			mc.ExpiresAt = &field
+		}
+
+		encrypted := tagContains(pmtag, []string{"encrypted"})
+		if encrypted {
+			mc.Encrypted = append(mc.Encrypted, jsonName(fpntr))
+		}
+
+		// Fields of unsupported types cannot be indexed
 		value, err := stringifyFieldValue(field, fpntr)
 		if err != nil {
-			log.Printf("[Error] NewModelCache: %v", err)
 			continue
 		}
 
@@ -91,6 +100,7 @@ func NewModelCache(rv reflect.Value) *ModelCache {
 			FieldName:    jstag,
 			FieldType:    fpntr.Type,
 			CurrentValue: value,
+			Encrypted:    encrypted,
 		}
 
 		if tagContains(pmtag, []string{"ranged", "index"}) {
@@ -112,6 +122,19 @@ func NewModelCache(rv reflect.Value) *ModelCache {
 	return mc
 }
 
+// collectionName returns the collection name of a model type, which is the
+// pluralized snake case form of the type's name, unless a field of the model
+// sets it with a collection option, e.g. pomdb:"id,collection=people".
+func collectionName(t reflect.Type) string {
+	for j := 0; j < t.NumField(); j++ {
+		if name, ok := tagValue(t.Field(j).Tag.Get("pomdb"), "collection"); ok && name != "" {
+			return name
+		}
+	}
+
+	return pluralize.NewClient().Plural(strcase.ToSnake(t.Name()))
+}
+
 // SetManagedFields sets the managed fields in the cache.
 func (mc *ModelCache) SetManagedFields() {
 	mc.ModelID.Set(reflect.ValueOf(NewULID()))
@@ -127,11 +150,37 @@ func (mc *ModelCache) SetManagedFields() {
 	}
 }
 
+// CopyManagedFields copies the ID and timestamps of an existing record into
+// the cache, and refreshes the UpdatedAt field.
+func (mc *ModelCache) CopyManagedFields(from *ModelCache) {
+	mc.ModelID.Set(*from.ModelID)
+
+	if mc.CreatedAt != nil && mc.CreatedAt.CanSet() && from.CreatedAt != nil {
+		mc.CreatedAt.Set(*from.CreatedAt)
+	}
+	if mc.DeletedAt != nil && mc.DeletedAt.CanSet() && from.DeletedAt != nil {
+		mc.DeletedAt.Set(*from.DeletedAt)
+	}
+
+	mc.SetUpdatedAt()
+}
+
 // GetModelID returns the model ID from the cache.
 func (mc *ModelCache) GetModelID() string {
 	return mc.ModelID.Interface().(ULID).String()
 }
 
+// GetIndexField returns the index field with the given name, or nil.
+func (mc *ModelCache) GetIndexField(name string) *IndexField {
+	for k := range mc.IndexFields {
+		if mc.IndexFields[k].FieldName == name {
+			return &mc.IndexFields[k]
+		}
+	}
+
+	return nil
+}
+
 // SetUpdatedAt sets the UpdatedAt field in the cache.
 func (mc *ModelCache) SetUpdatedAt() {
 	if mc.UpdatedAt != nil && mc.UpdatedAt.CanSet() {
@@ -141,11 +190,45 @@ func (mc *ModelCache) SetUpdatedAt() {
 
 // SetDeletedAt sets the DeletedAt field in the cache.
 func (mc *ModelCache) SetDeletedAt() {
+	if mc.DeletedAt != nil && mc.DeletedAt.CanSet() {
+		mc.DeletedAt.Set(reflect.ValueOf(NewTimestamp()))
+	}
+}
+
+// ClearDeletedAt clears the DeletedAt field in the cache.
+func (mc *ModelCache) ClearDeletedAt() {
 	if mc.DeletedAt != nil && mc.DeletedAt.CanSet() {
 		mc.DeletedAt.Set(reflect.ValueOf(NilTimestamp()))
 	}
 }
 
+// IsDeleted returns true if the cached record has a deletion time.
+func (mc *ModelCache) IsDeleted() bool {
+	return mc.DeletedAt != nil && !mc.DeletedAt.Interface().(Timestamp).IsNil()
+}
+
+// IsExpired returns true if the cached record has passed its expiry time,
+// given by its ttl field or by the collection's time-to-live.
+func (mc *ModelCache) IsExpired(ttl time.Duration) bool {
+	now := time.Now()
+
+	if mc.ExpiresAt != nil {
+		ts := mc.ExpiresAt.Interface().(Timestamp)
+		if !ts.IsNil() && !now.Before(time.Time(ts)) {
+			return true
+		}
+	}
+
+	if ttl > 0 && mc.CreatedAt != nil {
+		ts := mc.CreatedAt.Interface().(Timestamp)
+		if !ts.IsNil() && !now.Before(time.Time(ts).Add(ttl)) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // CompareIndexFields compares the index fields in the cache to the input.
 func (mc *ModelCache) CompareIndexFields(model interface{}) bool {
 	modval := reflect.ValueOf(model).Elem()
@@ -164,13 +247,11 @@ func (mc *ModelCache) CompareIndexFields(model interface{}) bool {
 	for k, index := range mc.IndexFields {
 		fldnme, ok := tagmap[index.FieldName]
 		if !ok {
-			log.Printf("json tag %s not found in model", index.FieldName)
 			continue
 		}
 
 		fldval := modval.FieldByName(fldnme)
 		if !fldval.IsValid() {
-			log.Printf("field %s not found in model", fldnme)
 			continue
 		}
 
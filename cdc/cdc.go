@@ -0,0 +1,461 @@
+// Package cdc turns the S3 event notifications of a PomDB bucket into
+// typed changes to its records. Notifications are parsed from the json
+// delivered to a queue or webhook, their keys are classified using the
+// PomDB layout, and the affected records are loaded with a client:
+//
+//	consumer := cdc.NewConsumer(&client)
+//	consumer.Register(&User{})
+//	consumer.Handle(func(ctx context.Context, ch cdc.Change) error {
+//	  log.Println(ch.Op, ch.Collection, ch.ID)
+//	  return nil
+//	})
+//
+//	err := consumer.Process(ctx, []byte(msg.Body))
+//
+// Notifications are delivered at least once and out of order, and records
+// are loaded when their events are handled, so handlers should be
+// idempotent and may see a newer state than the one an event reports.
+//
+// In collections with history, the version a write stored is matched by the
+// event's ETag, so records before and after the write are read from their
+// versions, and writes of new records are reported as creations. Without
+// history, or if the version is no longer stored, writes are reported as
+// updates, with the current record and without the record before them.
+package cdc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pomdb/pomdb-go"
+)
+
+// Op is the kind of change made to a record or index item.
+type Op string
+
+const (
+	// OpCreate is a record or index item being created.
+	OpCreate Op = "create"
+
+	// OpUpdate is a record being updated.
+	OpUpdate Op = "update"
+
+	// OpDelete is a record being permanently deleted, or an index item
+	// being deleted.
+	OpDelete Op = "delete"
+
+	// OpTrash is a record being soft-deleted.
+	OpTrash Op = "trash"
+
+	// OpRestore is a soft-deleted record being restored.
+	OpRestore Op = "restore"
+)
+
+// KeyKind is the kind of object a key holds in the PomDB layout.
+type KeyKind int
+
+const (
+	// KeyOther is any object that is not a record, index item or trash
+	// marker, such as record versions and manifests.
+	KeyOther KeyKind = iota
+
+	// KeyRecord is a record, at {collection}/{id}.
+	KeyRecord
+
+	// KeyIndex is a live or trashed index item.
+	KeyIndex
+
+	// KeyTrash marks a record as soft-deleted, at {collection}/trash/{id}.
+	KeyTrash
+)
+
+// Key is an object key classified by ParseKey.
+type Key struct {
+	Kind       KeyKind
+	Collection string
+	ID         string
+
+	// Index is the decoded key of index items.
+	Index *pomdb.IndexKey
+}
+
+// ParseKey classifies an object key using the PomDB layout.
+func ParseKey(key string) Key {
+	parts := strings.Split(key, "/")
+	if len(parts) < 2 || strings.HasPrefix(key, "_pomdb/") {
+		return Key{Kind: KeyOther}
+	}
+
+	switch {
+	case len(parts) == 2 && isULID(parts[1]):
+		return Key{Kind: KeyRecord, Collection: parts[0], ID: parts[1]}
+	case len(parts) == 3 && parts[1] == "trash" && isULID(parts[2]):
+		return Key{Kind: KeyTrash, Collection: parts[0], ID: parts[2]}
+	case parts[1] == "indexes" || parts[1] == "trash":
+		if ik, err := pomdb.ParseIndexKey(key); err == nil && isULID(ik.ID) {
+			return Key{Kind: KeyIndex, Collection: ik.Collection, ID: ik.ID, Index: ik}
+		}
+	}
+
+	return Key{Kind: KeyOther, Collection: parts[0]}
+}
+
+// Change is a change to a record, or to an index item with Indexes.
+type Change struct {
+	Op Op
+
+	// Kind is KeyRecord for changes to records, including soft deletes and
+	// restores, and KeyIndex for changes to index items.
+	Kind KeyKind
+
+	Collection string
+	ID         string
+
+	// Index is the decoded key of changed index items.
+	Index *pomdb.IndexKey
+
+	// Before is the record before an update, in collections with history.
+	// After is the record after it was created, updated, soft-deleted or
+	// restored. Both are pointers to the registered model type.
+	Before interface{}
+	After  interface{}
+
+	// Event is the notification the change was read from.
+	Event Event
+}
+
+// Handler is called with each change. Returning an error stops the
+// processing of a notification, so it can be retried.
+type Handler func(ctx context.Context, ch Change) error
+
+// Consumer dispatches the changes read from event notifications to
+// handlers. Events of other buckets and unregistered collections are
+// ignored.
+type Consumer struct {
+	Client *pomdb.Client
+
+	// Indexes dispatches changes to index items, as well as records.
+	Indexes bool
+
+	mu       sync.Mutex
+	models   map[string]reflect.Type
+	history  map[string]bool
+	handlers []Handler
+}
+
+// NewConsumer returns a consumer that loads records with c.
+func NewConsumer(c *pomdb.Client) *Consumer {
+	return &Consumer{
+		Client:  c,
+		models:  make(map[string]reflect.Type),
+		history: make(map[string]bool),
+	}
+}
+
+// Register registers the models whose changes are dispatched.
+func (cs *Consumer) Register(models ...interface{}) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for _, model := range models {
+		rv := reflect.ValueOf(model)
+		if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("[Error] Register: %w: model must be a pointer to a struct", pomdb.ErrInvalidModel)
+		}
+
+		ca := pomdb.NewModelCache(rv.Elem())
+		if ca.ModelID == nil {
+			return fmt.Errorf("[Error] Register: %w: model must have an 'id' field", pomdb.ErrInvalidModel)
+		}
+
+		cs.models[ca.Collection] = rv.Elem().Type()
+	}
+
+	return nil
+}
+
+// Handle adds a handler, called with every change in registration order.
+func (cs *Consumer) Handle(h Handler) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.handlers = append(cs.handlers, h)
+}
+
+// Process dispatches the changes of an event notification payload.
+func (cs *Consumer) Process(ctx context.Context, payload []byte) error {
+	events, err := ParseEvents(payload)
+	if err != nil {
+		return err
+	}
+
+	return cs.ProcessEvents(ctx, events...)
+}
+
+// ProcessEvents dispatches the changes of events, in order.
+func (cs *Consumer) ProcessEvents(ctx context.Context, events ...Event) error {
+	for _, ev := range events {
+		ch, err := cs.change(ctx, ev)
+		if err != nil {
+			return fmt.Errorf("[Error] ProcessEvents: key=%s: %w", ev.Key, err)
+		}
+
+		if ch == nil {
+			continue
+		}
+
+		cs.mu.Lock()
+		handlers := cs.handlers
+		cs.mu.Unlock()
+
+		for _, h := range handlers {
+			if err := h(ctx, *ch); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// change returns the change an event reports, or nil if it is not a change
+// to dispatch.
+func (cs *Consumer) change(ctx context.Context, ev Event) (*Change, error) {
+	if ev.Bucket != "" && ev.Bucket != cs.Client.Bucket {
+		return nil, nil
+	}
+
+	if !ev.Created() && !ev.Removed() {
+		return nil, nil
+	}
+
+	key := ParseKey(ev.Key)
+
+	cs.mu.Lock()
+	typ, ok := cs.models[key.Collection]
+	cs.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+
+	ch := &Change{
+		Kind:       KeyRecord,
+		Collection: key.Collection,
+		ID:         key.ID,
+		Event:      ev,
+	}
+
+	switch key.Kind {
+	case KeyIndex:
+		if !cs.Indexes {
+			return nil, nil
+		}
+
+		ch.Kind, ch.Index, ch.Op = KeyIndex, key.Index, OpCreate
+		if ev.Removed() {
+			ch.Op = OpDelete
+		}
+
+		return ch, nil
+
+	case KeyRecord:
+		if ev.Removed() {
+			ch.Op = OpDelete
+			return ch, nil
+		}
+
+		return cs.recordChange(ctx, typ, ch)
+
+	case KeyTrash:
+		after, err := cs.find(ctx, typ, key.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if ev.Created() {
+			ch.Op, ch.After = OpTrash, after
+			return ch, nil
+		}
+
+		// Markers are also removed when trashed records are purged
+		if after == nil {
+			return nil, nil
+		}
+
+		trashed, err := cs.isTrashed(ctx, typ, key.ID, after)
+		if err != nil || trashed {
+			return nil, err
+		}
+
+		ch.Op, ch.After = OpRestore, after
+		return ch, nil
+	}
+
+	return nil, nil
+}
+
+// recordChange completes the change of a record being written. Records are
+// also written when they are soft-deleted and restored, which are reported
+// by their trash markers instead. In collections with history, the version
+// written by the event is matched by its ETag, and the version before it is
+// the record before the write. Otherwise, the write is reported as an
+// update of the current record, without the record before it.
+func (cs *Consumer) recordChange(ctx context.Context, typ reflect.Type, ch *Change) (*Change, error) {
+	history, err := cs.keepsHistory(ctx, ch.Collection)
+	if err != nil {
+		return nil, err
+	}
+
+	ch.Op = OpUpdate
+	if history {
+		model, err := newModel(typ, ch.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		versions, err := cs.Client.WithContext(ctx).History(model)
+		if err != nil {
+			return nil, err
+		}
+
+		if i := matchVersion(versions, ch.Event.ETag); i >= 0 {
+			ch.After = versions[i].Doc
+			if i > 0 {
+				ch.Before = versions[i-1].Doc
+			} else {
+				ch.Op = OpCreate
+			}
+		}
+	}
+
+	if ch.After == nil {
+		after, err := cs.find(ctx, typ, ch.ID)
+		if err != nil || after == nil {
+			return nil, err
+		}
+
+		ch.After = after
+	}
+
+	// Skip soft deletes and restores
+	trashed, err := cs.isTrashed(ctx, typ, ch.ID, ch.After)
+	if err != nil || trashed {
+		return nil, err
+	}
+
+	if ch.Before != nil && pomdb.NewModelCache(reflect.ValueOf(ch.Before).Elem()).IsDeleted() {
+		return nil, nil
+	}
+
+	return ch, nil
+}
+
+// find returns a record, including soft-deleted ones, or nil if it does not
+// exist.
+func (cs *Consumer) find(ctx context.Context, typ reflect.Type, id string) (interface{}, error) {
+	model, err := newModel(typ, id)
+	if err != nil {
+		return nil, err
+	}
+
+	q := pomdb.Query{Model: model, Field: "id", Value: id, Trashed: pomdb.QueryWithTrashed}
+
+	record, err := cs.Client.WithContext(ctx).FindOne(q)
+	if err != nil && errors.Is(err, pomdb.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// isTrashed reports whether a record is soft-deleted. Records without a
+// deleted_at field are looked up among the soft-deleted records.
+func (cs *Consumer) isTrashed(ctx context.Context, typ reflect.Type, id string, record interface{}) (bool, error) {
+	ca := pomdb.NewModelCache(reflect.ValueOf(record).Elem())
+	if ca.DeletedAt != nil {
+		return ca.IsDeleted(), nil
+	}
+
+	model, err := newModel(typ, id)
+	if err != nil {
+		return false, err
+	}
+
+	q := pomdb.Query{Model: model, Field: "id", Value: id, Trashed: pomdb.QueryOnlyTrashed}
+
+	_, err = cs.Client.WithContext(ctx).FindOne(q)
+	if err != nil && errors.Is(err, pomdb.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// keepsHistory reports whether a collection keeps history, according to its
+// manifest.
+func (cs *Consumer) keepsHistory(ctx context.Context, collection string) (bool, error) {
+	cs.mu.Lock()
+	history, ok := cs.history[collection]
+	cs.mu.Unlock()
+	if ok {
+		return history, nil
+	}
+
+	manifest, err := cs.Client.Collection(ctx, collection)
+	if err != nil && !errors.Is(err, pomdb.ErrNotFound) {
+		return false, err
+	}
+
+	history = manifest != nil && manifest.History
+
+	cs.mu.Lock()
+	cs.history[collection] = history
+	cs.mu.Unlock()
+
+	return history, nil
+}
+
+// newModel returns a new instance of a model type holding the given ID.
+func newModel(typ reflect.Type, id string) (interface{}, error) {
+	uid, err := pomdb.ParseULID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := reflect.New(typ)
+	pomdb.NewModelCache(rv.Elem()).ModelID.Set(reflect.ValueOf(uid))
+
+	return rv.Interface(), nil
+}
+
+// matchVersion returns the index of the version with the given ETag, or -1
+// if there is none. Versions written with the same body have the same ETag,
+// so the latest is matched.
+func matchVersion(versions []pomdb.Version, etag string) int {
+	etag = strings.Trim(etag, `"`)
+	if etag == "" {
+		return -1
+	}
+
+	for i := len(versions) - 1; i >= 0; i-- {
+		if strings.Trim(versions[i].ETag, `"`) == etag {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// isULID reports whether s is a valid ULID.
+func isULID(s string) bool {
+	_, err := pomdb.ParseULID(s)
+	return err == nil
+}
@@ -0,0 +1,269 @@
+package cdc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pomdb/pomdb-go"
+	"github.com/pomdb/pomdb-go/local"
+)
+
+type user struct {
+	pomdb.Model
+	Name  string `json:"name" pomdb:"index"`
+	Email string `json:"email" pomdb:"index,unique"`
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want Key
+	}{
+		{"record", "users/" + fixtureID, Key{Kind: KeyRecord, Collection: "users", ID: fixtureID}},
+		{"trash marker", "users/trash/" + fixtureID, Key{Kind: KeyTrash, Collection: "users", ID: fixtureID}},
+		{"index", "users/indexes/unique/email/am9obkB6aXAuY29t/" + fixtureID, Key{Kind: KeyIndex, Collection: "users", ID: fixtureID}},
+		{"trashed index", "users/trash/unique/email/am9obkB6aXAuY29t/" + fixtureID, Key{Kind: KeyIndex, Collection: "users", ID: fixtureID}},
+		{"index value with slashes", "users/indexes/shared/name/Pj4/Pw==/" + fixtureID, Key{Kind: KeyIndex, Collection: "users", ID: fixtureID}},
+		{"version", "users/versions/" + fixtureID + "/1710936000000000000", Key{Kind: KeyOther, Collection: "users"}},
+		{"changelog", "users/_changes/" + fixtureID, Key{Kind: KeyOther, Collection: "users"}},
+		{"invalid id", "users/john", Key{Kind: KeyOther, Collection: "users"}},
+		{"manifest", "_pomdb/collections/users.json", Key{Kind: KeyOther}},
+		{"top level", "users", Key{Kind: KeyOther}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseKey(tt.key)
+			if got.Kind != tt.want.Kind || got.Collection != tt.want.Collection || got.ID != tt.want.ID {
+				t.Errorf("ParseKey(%s) = %+v, want %+v", tt.key, got, tt.want)
+			}
+
+			if (got.Kind == KeyIndex) != (got.Index != nil) {
+				t.Errorf("ParseKey(%s).Index = %+v", tt.key, got.Index)
+			}
+		})
+	}
+
+	if ik := ParseKey("users/indexes/shared/name/Pj4/Pw==/" + fixtureID).Index; ik.Value != ">>??" {
+		t.Errorf("index value = %q, want >>??", ik.Value)
+	}
+}
+
+// newConsumer returns a consumer of a local bucket holding the fixtures'
+// record, in a collection registered with opts.
+func newConsumer(t *testing.T, opts pomdb.CollectionOptions) (*Consumer, *pomdb.Client) {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := local.CreateBucket(dir, "pomdb"); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &pomdb.Client{
+		Service:     local.NewService(dir),
+		Bucket:      "pomdb",
+		Region:      "us-east-1",
+		SoftDeletes: true,
+	}
+
+	if err := c.Register(&user{}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := `{"id":"` + fixtureID + `","name":"John","email":"john@zip.com"}`
+	if _, err := c.Import(context.Background(), &user{}, strings.NewReader(rec), pomdb.ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := NewConsumer(c)
+	if err := cs.Register(&user{}); err != nil {
+		t.Fatal(err)
+	}
+
+	return cs, c
+}
+
+// fixtureUser returns the fixtures' record.
+func fixtureUser(t *testing.T) *user {
+	t.Helper()
+
+	id, err := pomdb.ParseULID(fixtureID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &user{Model: pomdb.Model{ID: id}}
+}
+
+// versionETag returns the ETag of a version of the fixtures' record.
+func versionETag(t *testing.T, c *pomdb.Client, i int) string {
+	t.Helper()
+
+	versions, err := c.History(fixtureUser(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Trim(versions[i].ETag, `"`)
+}
+
+func TestConsumerChangeRecord(t *testing.T) {
+	cs, _ := newConsumer(t, pomdb.CollectionOptions{})
+
+	ch, err := cs.change(context.Background(), fixtureEvent(t, "record.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without history, writes are updates of the current record
+	if ch == nil || ch.Op != OpUpdate || ch.Kind != KeyRecord || ch.Collection != "users" || ch.ID != fixtureID {
+		t.Fatalf("change = %+v", ch)
+	}
+
+	if ch.Before != nil || ch.After.(*user).Name != "John" {
+		t.Errorf("before = %+v, after = %+v", ch.Before, ch.After)
+	}
+}
+
+func TestConsumerChangeHistory(t *testing.T) {
+	cs, c := newConsumer(t, pomdb.CollectionOptions{History: true})
+
+	u := fixtureUser(t)
+	u.Name, u.Email = "Jane", "john@zip.com"
+	if _, err := c.Update(u); err != nil {
+		t.Fatal(err)
+	}
+
+	u.Name = "Joan"
+	if _, err := c.Update(u); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := fixtureEvent(t, "record.json")
+
+	// The event of the creation is matched to the first version
+	ev.ETag = versionETag(t, c, 0)
+	ch, err := cs.change(context.Background(), ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ch == nil || ch.Op != OpCreate || ch.Before != nil || ch.After.(*user).Name != "John" {
+		t.Fatalf("change = %+v", ch)
+	}
+
+	// Updates are paired with the version before them, however recent
+	ev.ETag = versionETag(t, c, 1)
+	ch, err = cs.change(context.Background(), ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ch == nil || ch.Op != OpUpdate || ch.Before.(*user).Name != "John" || ch.After.(*user).Name != "Jane" {
+		t.Fatalf("change = %+v", ch)
+	}
+
+	// Writes whose version is unknown are updates of the current record
+	ev.ETag = "d41d8cd98f00b204e9800998ecf8427e"
+	ch, err = cs.change(context.Background(), ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ch == nil || ch.Op != OpUpdate || ch.Before != nil || ch.After.(*user).Name != "Joan" {
+		t.Fatalf("change = %+v", ch)
+	}
+}
+
+func TestConsumerChangeRemoved(t *testing.T) {
+	cs, _ := newConsumer(t, pomdb.CollectionOptions{})
+
+	ch, err := cs.change(context.Background(), fixtureEvent(t, "sns.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ch == nil || ch.Op != OpDelete || ch.ID != fixtureID || ch.After != nil {
+		t.Fatalf("change = %+v", ch)
+	}
+}
+
+func TestConsumerChangeIndex(t *testing.T) {
+	cs, _ := newConsumer(t, pomdb.CollectionOptions{})
+	ev := fixtureEvent(t, "index.json")
+
+	ch, err := cs.change(context.Background(), ev)
+	if err != nil || ch != nil {
+		t.Fatalf("change without Indexes = %+v, %v", ch, err)
+	}
+
+	cs.Indexes = true
+	ch, err = cs.change(context.Background(), ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ch == nil || ch.Op != OpCreate || ch.Kind != KeyIndex || ch.Index.Field != "email" || ch.Index.Value != "john@zip.com" {
+		t.Fatalf("change = %+v", ch)
+	}
+}
+
+func TestConsumerChangeTrash(t *testing.T) {
+	cs, c := newConsumer(t, pomdb.CollectionOptions{})
+	ev := fixtureEvent(t, "trash.json")
+
+	if _, err := c.SoftDelete(fixtureUser(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := cs.change(context.Background(), ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ch == nil || ch.Op != OpTrash || ch.Kind != KeyRecord || ch.After == nil {
+		t.Fatalf("change = %+v", ch)
+	}
+
+	// Writing the soft-deleted record is reported by its trash marker
+	ch, err = cs.change(context.Background(), fixtureEvent(t, "record.json"))
+	if err != nil || ch != nil {
+		t.Fatalf("record change = %+v, %v", ch, err)
+	}
+
+	if _, err := c.Restore(fixtureUser(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	ev.Name = "ObjectRemoved:Delete"
+	ch, err = cs.change(context.Background(), ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ch == nil || ch.Op != OpRestore || ch.After == nil {
+		t.Fatalf("change = %+v", ch)
+	}
+}
+
+func TestConsumerChangeIgnored(t *testing.T) {
+	cs, _ := newConsumer(t, pomdb.CollectionOptions{})
+
+	other := fixtureEvent(t, "record.json")
+	other.Bucket = "other"
+
+	unregistered := fixtureEvent(t, "record.json")
+	unregistered.Key = "accounts/" + fixtureID
+
+	version := fixtureEvent(t, "record.json")
+	version.Key = "users/versions/" + fixtureID + "/1710936000000000000"
+
+	for _, ev := range []Event{other, unregistered, version} {
+		ch, err := cs.change(context.Background(), ev)
+		if err != nil || ch != nil {
+			t.Errorf("%s: change = %+v, %v", ev.Key, ch, err)
+		}
+	}
+}
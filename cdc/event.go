@@ -0,0 +1,110 @@
+package cdc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Event is an S3 event notification for an object.
+type Event struct {
+	// Name is the event type, e.g. ObjectCreated:Put or
+	// ObjectRemoved:Delete.
+	Name string
+
+	// Time is when the request that caused the event was made.
+	Time time.Time
+
+	Bucket string
+	Key    string
+	ETag   string
+	Size   int64
+
+	// Sequencer orders the events of a key: of two events for the same
+	// key, the one with the greater sequencer happened later. Events are
+	// not delivered in order, and consumers dispatch them as they arrive,
+	// so handlers that need the latest state of a key compare sequencers.
+	Sequencer string
+}
+
+// Created reports whether the event is an object being written.
+func (e Event) Created() bool {
+	return strings.HasPrefix(e.Name, "ObjectCreated:")
+}
+
+// Removed reports whether the event is an object being deleted.
+func (e Event) Removed() bool {
+	return strings.HasPrefix(e.Name, "ObjectRemoved:")
+}
+
+// notification is the payload of an S3 event notification.
+type notification struct {
+	Records []struct {
+		EventSource string    `json:"eventSource"`
+		EventName   string    `json:"eventName"`
+		EventTime   time.Time `json:"eventTime"`
+		S3          struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key       string `json:"key"`
+				Size      int64  `json:"size"`
+				ETag      string `json:"eTag"`
+				Sequencer string `json:"sequencer"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+
+	// Test notifications are sent when notifications are configured
+	Event string `json:"Event"`
+
+	// Notifications delivered through SNS are wrapped in a message
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// ParseEvents decodes the events of an S3 event notification, as delivered
+// to a queue or webhook, directly or through an SNS topic. Test
+// notifications have no events.
+func ParseEvents(payload []byte) ([]Event, error) {
+	var n notification
+	if err := json.Unmarshal(payload, &n); err != nil {
+		return nil, fmt.Errorf("[Error] ParseEvents: invalid notification: %w", err)
+	}
+
+	if n.Type == "Notification" {
+		return ParseEvents([]byte(n.Message))
+	}
+
+	if n.Event == "s3:TestEvent" {
+		return nil, nil
+	}
+
+	events := make([]Event, 0, len(n.Records))
+	for _, r := range n.Records {
+		if r.EventSource != "aws:s3" {
+			continue
+		}
+
+		// Keys are URL-encoded, with spaces as plus signs
+		key, err := url.QueryUnescape(r.S3.Object.Key)
+		if err != nil {
+			return nil, fmt.Errorf("[Error] ParseEvents: invalid key %s: %w", r.S3.Object.Key, err)
+		}
+
+		events = append(events, Event{
+			Name:      r.EventName,
+			Time:      r.EventTime,
+			Bucket:    r.S3.Bucket.Name,
+			Key:       key,
+			ETag:      r.S3.Object.ETag,
+			Size:      r.S3.Object.Size,
+			Sequencer: r.S3.Object.Sequencer,
+		})
+	}
+
+	return events, nil
+}
@@ -0,0 +1,122 @@
+package cdc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fixtureID is the ID of the record the fixtures' events are about.
+const fixtureID = "01HS8Q7MVGA8CVCVVFYEH1VY2T"
+
+// fixture returns the payload of a notification in testdata.
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// fixtureEvent returns the only event of a notification in testdata.
+func fixtureEvent(t *testing.T, name string) Event {
+	t.Helper()
+
+	events, err := ParseEvents(fixture(t, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("%s: got %d events, want 1", name, len(events))
+	}
+
+	return events[0]
+}
+
+func TestParseEvents(t *testing.T) {
+	events, err := ParseEvents(fixture(t, "direct.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Event{
+		{
+			Name:      "ObjectCreated:Put",
+			Time:      time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC),
+			Bucket:    "pomdb",
+			Key:       "users/" + fixtureID,
+			ETag:      "d41d8cd98f00b204e9800998ecf8427e",
+			Size:      118,
+			Sequencer: "0062E99A88DC407460",
+		},
+		{
+			Name:      "ObjectCreated:Put",
+			Time:      time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC),
+			Bucket:    "pomdb",
+			Key:       "users/indexes/unique/email/am9obkB6aXAuY29t/" + fixtureID,
+			ETag:      "d41d8cd98f00b204e9800998ecf8427e",
+			Sequencer: "0062E99A88DC407461",
+		},
+	}
+
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+
+	for i := range want {
+		if !events[i].Time.Equal(want[i].Time) {
+			t.Errorf("event %d: time = %v, want %v", i, events[i].Time, want[i].Time)
+		}
+
+		events[i].Time = want[i].Time
+		if events[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, events[i], want[i])
+		}
+	}
+
+	if !events[0].Created() || events[0].Removed() {
+		t.Errorf("event 0: Created = %v, Removed = %v", events[0].Created(), events[0].Removed())
+	}
+}
+
+func TestParseEventsSNS(t *testing.T) {
+	ev := fixtureEvent(t, "sns.json")
+
+	if ev.Name != "ObjectRemoved:Delete" || ev.Key != "users/"+fixtureID {
+		t.Errorf("event = %+v", ev)
+	}
+
+	if ev.Created() || !ev.Removed() {
+		t.Errorf("Created = %v, Removed = %v", ev.Created(), ev.Removed())
+	}
+}
+
+func TestParseEventsTestEvent(t *testing.T) {
+	events, err := ParseEvents(fixture(t, "test_event.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 0 {
+		t.Errorf("got %d events, want none", len(events))
+	}
+}
+
+func TestParseEventsURLEncodedKey(t *testing.T) {
+	ev := fixtureEvent(t, "urlencoded_key.json")
+
+	if want := "users/indexes/shared/name/w7w+Pw==/" + fixtureID; ev.Key != want {
+		t.Errorf("key = %s, want %s", ev.Key, want)
+	}
+}
+
+func TestParseEventsInvalid(t *testing.T) {
+	if _, err := ParseEvents([]byte("not json")); err == nil {
+		t.Error("ParseEvents of an invalid payload succeeded")
+	}
+}
@@ -0,0 +1,348 @@
+package pomdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/oklog/ulid/v2"
+)
+
+// ChangeOp is the operation recorded by a changelog entry.
+type ChangeOp string
+
+const (
+	// ChangeCreate is a record being created.
+	ChangeCreate ChangeOp = "create"
+
+	// ChangeUpdate is a record being updated, patched, reverted or
+	// migrated.
+	ChangeUpdate ChangeOp = "update"
+
+	// ChangeDelete is a record being soft-deleted.
+	ChangeDelete ChangeOp = "delete"
+
+	// ChangeRestore is a soft-deleted record being restored.
+	ChangeRestore ChangeOp = "restore"
+
+	// ChangePurge is a record being permanently deleted.
+	ChangePurge ChangeOp = "purge"
+)
+
+const (
+	metaChangeOp     = "pomdb-change-op"
+	metaChangeRecord = "pomdb-change-record"
+)
+
+// ChangesLimitDefault is the maximum number of entries returned by Changes.
+const ChangesLimitDefault = 1000
+
+// ChangesSettleTime is how old changelog entries must be to be returned by
+// Changes. Entries are ordered by the time their IDs are generated, but
+// become visible when they are written, so recent entries are held back
+// until entries generated before them are written.
+const ChangesSettleTime = 5 * time.Second
+
+// Change is an entry of a collection's changelog.
+type Change struct {
+	// ID orders the entries of the changelog, and is the cursor passed to
+	// Changes to read the entries after it.
+	ID string
+
+	Op       ChangeOp
+	RecordID string
+
+	// Timestamp is when the change was made.
+	Timestamp Timestamp
+
+	// Doc is the record after the change, or nil for purges.
+	Doc interface{}
+}
+
+// ChangeFeed is a page of a collection's changelog.
+type ChangeFeed struct {
+	Changes []Change
+
+	// Cursor is the ID of the last entry read, or the cursor Changes was
+	// called with if there are none, to read the next page from.
+	Cursor string
+}
+
+// Changes returns the entries of a collection's changelog after the given
+// cursor, oldest first, or from the start of the changelog with an empty
+// cursor. Calling Changes again with the returned cursor tails the
+// changelog. Collections record their changes when registered with the
+// Changelog option.
+func (c *Client) Changes(ctx context.Context, model interface{}, since string) (*ChangeFeed, error) {
+	c = c.WithContext(ctx)
+
+	// Dereference the input
+	rv, err := dereferenceStruct(model)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the struct cache
+	ca := NewModelCache(rv)
+
+	pfx := encodeChangePrefix(ca.Collection)
+	lst := &s3.ListObjectsV2Input{
+		Bucket:  &c.Bucket,
+		Prefix:  aws.String(pfx),
+		MaxKeys: aws.Int32(ChangesLimitDefault),
+	}
+
+	if since != "" {
+		lst.StartAfter = aws.String(pfx + since)
+	}
+
+	res, err := c.Service.ListObjectsV2(c.context(), lst, c.apiOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hold back entries that have not settled
+	settled := time.Now().Add(-ChangesSettleTime)
+
+	var keys []string
+	for _, obj := range res.Contents {
+		ts, err := decodeChangeKey(*obj.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		if time.Time(ts).After(settled) {
+			break
+		}
+
+		keys = append(keys, *obj.Key)
+	}
+
+	feed := &ChangeFeed{Changes: make([]Change, len(keys)), Cursor: since}
+
+	err = c.forEach(len(keys), func(i int) error {
+		ch, err := c.getChange(ca, keys[i])
+		if err != nil {
+			return err
+		}
+
+		feed.Changes[i] = *ch
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("[Error] Changes: %w", err)
+	}
+
+	if len(keys) > 0 {
+		feed.Cursor = feed.Changes[len(keys)-1].ID
+	}
+
+	return feed, nil
+}
+
+// PurgeChanges deletes the entries of a collection's changelog that are
+// more than olderThan old, and returns the number deleted.
+func (c *Client) PurgeChanges(ctx context.Context, model interface{}, olderThan time.Duration) (int, error) {
+	c = c.WithContext(ctx)
+
+	// Dereference the input
+	rv, err := dereferenceStruct(model)
+	if err != nil {
+		return 0, err
+	}
+
+	// Build the struct cache
+	ca := NewModelCache(rv)
+
+	objs, err := c.listObjects(encodeChangePrefix(ca.Collection))
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+
+	// Entries are ordered by time
+	var keys []string
+	for _, obj := range objs {
+		ts, err := decodeChangeKey(*obj.Key)
+		if err != nil {
+			return 0, err
+		}
+
+		if !time.Time(ts).Before(cutoff) {
+			break
+		}
+
+		keys = append(keys, *obj.Key)
+	}
+
+	err = c.forEach(len(keys), func(i int) error {
+		del := &s3.DeleteObjectInput{
+			Bucket: &c.Bucket,
+			Key:    aws.String(keys[i]),
+		}
+
+		_, err := c.Service.DeleteObject(c.context(), del, c.apiOptions()...)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("[Error] PurgeChanges: %w", err)
+	}
+
+	return len(keys), nil
+}
+
+// appendChange appends an entry to the changelog of the cached collection,
+// if it keeps one. The entry holds the record after the change, encoded as
+// it is stored, or nothing for purges.
+func (c *Client) appendChange(ca *ModelCache, op ChangeOp, i interface{}) error {
+	if !c.options(ca.Collection).Changelog {
+		return nil
+	}
+
+	key := encodeChangePrefix(ca.Collection) + NewULID().String()
+
+	put := &s3.PutObjectInput{
+		Bucket: &c.Bucket,
+		Key:    &key,
+		Metadata: map[string]string{
+			metaChangeOp:     string(op),
+			metaChangeRecord: ca.GetModelID(),
+		},
+	}
+
+	if i != nil {
+		er, err := c.encodeRecord(ca, i)
+		if err != nil {
+			return err
+		}
+
+		for k, v := range er.meta {
+			put.Metadata[k] = v
+		}
+
+		put.Body = bytes.NewReader(er.body)
+		put.ContentType = er.contentType
+		put.ContentEncoding = er.contentEncoding
+	}
+
+	c.logDebug("append change", "collection", ca.Collection, "op", op, "key", key)
+
+	if _, err := c.Service.PutObject(c.context(), put, c.apiOptions()...); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// appendStoredChange appends an entry to a collection's changelog for the
+// record stored with the given ID, holding the record as it is stored, or
+// nothing for purges. It is used where the collection's model is unknown.
+func (c *Client) appendStoredChange(collection, id string, op ChangeOp) error {
+	key := encodeChangePrefix(collection) + NewULID().String()
+
+	put := &s3.PutObjectInput{
+		Bucket: &c.Bucket,
+		Key:    &key,
+		Metadata: map[string]string{
+			metaChangeOp:     string(op),
+			metaChangeRecord: id,
+		},
+	}
+
+	if op != ChangePurge {
+		get := &s3.GetObjectInput{
+			Bucket: &c.Bucket,
+			Key:    aws.String(collection + "/" + id),
+		}
+
+		doc, err := c.Service.GetObject(c.context(), get, c.apiOptions()...)
+		if err != nil {
+			return err
+		}
+		defer doc.Body.Close()
+
+		body, err := io.ReadAll(doc.Body)
+		if err != nil {
+			return err
+		}
+
+		for k, v := range doc.Metadata {
+			put.Metadata[k] = v
+		}
+
+		put.Body = bytes.NewReader(body)
+		put.ContentType = doc.ContentType
+		put.ContentEncoding = doc.ContentEncoding
+	}
+
+	c.logDebug("append change", "collection", collection, "op", op, "key", key)
+
+	if _, err := c.Service.PutObject(c.context(), put, c.apiOptions()...); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// getChange fetches and decodes the changelog entry stored at key.
+func (c *Client) getChange(ca *ModelCache, key string) (*Change, error) {
+	ts, err := decodeChangeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	get := &s3.GetObjectInput{
+		Bucket: &c.Bucket,
+		Key:    &key,
+	}
+
+	var noSuchKey *types.NoSuchKey
+	doc, err := c.Service.GetObject(c.context(), get, c.apiOptions()...)
+	if err != nil && errors.As(err, &noSuchKey) {
+		return nil, fmt.Errorf("[Error] getChange: %w: key=%s: %w", ErrNotFound, key, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	ch := &Change{
+		ID:        key[strings.LastIndex(key, "/")+1:],
+		Op:        ChangeOp(doc.Metadata[metaChangeOp]),
+		RecordID:  doc.Metadata[metaChangeRecord],
+		Timestamp: ts,
+	}
+
+	if ch.Op == ChangePurge {
+		doc.Body.Close()
+		return ch, nil
+	}
+
+	if ch.Doc, err = c.decodeRecord(ca, key, doc); err != nil {
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+// encodeChangePrefix returns the prefix of a collection's changelog. The
+// changelog is nested under the collection, so it is not listed as records.
+func encodeChangePrefix(collection string) string {
+	return collection + "/_changes/"
+}
+
+// decodeChangeKey returns the time a changelog entry was generated.
+func decodeChangeKey(key string) (Timestamp, error) {
+	id, err := ulid.Parse(key[strings.LastIndex(key, "/")+1:])
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("[Error] decodeChangeKey: invalid change key %s: %w", key, err)
+	}
+
+	return Timestamp(ulid.Time(id.Time())), nil
+}
@@ -4,12 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Client struct {
@@ -19,11 +21,44 @@ type Client struct {
 	SoftDeletes bool
 	Pessimistic bool
 	Optimistic  bool
+	Logger      *slog.Logger
+	Encryptor   *Encryptor
+	Codec       Codec
+	Concurrency int
+
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+
+	collections map[string]CollectionOptions
+	models      map[string]*ModelCache
+	ctx         context.Context
+	middleware  []Middleware
+	tel         *telemetryState
+}
+
+// WithContext returns a shallow copy of the client that uses ctx for its
+// operations, e.g. to set deadlines or cancel requests.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	// Share the client's telemetry with the copy
+	c.telemetryState()
+
+	cc := *c
+	cc.ctx = ctx
+	return &cc
+}
+
+// context returns the context used for the client's operations.
+func (c *Client) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+
+	return c.ctx
 }
 
 func (c *Client) Connect() error {
 	conf, err := config.LoadDefaultConfig(
-		context.TODO(),
+		c.context(),
 		config.WithRegion(c.Region),
 	)
 	if err != nil {
@@ -33,10 +68,14 @@ func (c *Client) Connect() error {
 	c.Service = s3.NewFromConfig(conf)
 
 	if err := c.CheckBucket(); err != nil {
-		return fmt.Errorf("bucket %s does not exist", c.Bucket)
+		return fmt.Errorf("[Error] Connect: bucket %s does not exist: %w", c.Bucket, err)
 	}
 
-	log.Printf("connected to %s", c.Bucket)
+	if err := c.writeManifests(); err != nil {
+		return fmt.Errorf("[Error] Connect: %w", err)
+	}
+
+	c.logger().Info("connected", "bucket", c.Bucket, "region", c.Region)
 
 	return nil
 }
@@ -46,15 +85,53 @@ func (c *Client) CheckBucket() error {
 		Bucket: &c.Bucket,
 	}
 
-	if _, err := c.Service.HeadBucket(context.TODO(), head); err != nil {
+	if _, err := c.Service.HeadBucket(c.context(), head, c.apiOptions()...); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-// CheckIndexExists checks if an index item exists in the given collection.
+// listObjects returns every object under the given prefix.
+func (c *Client) listObjects(pfx string) ([]types.Object, error) {
+	return c.listObjectsAfter(pfx, "", false)
+}
+
+// listObjectsAfter returns every object under the given prefix that sorts
+// after startAfter. With a delimiter, objects in nested paths are skipped.
+func (c *Client) listObjectsAfter(pfx, startAfter string, delimiter bool) ([]types.Object, error) {
+	lst := &s3.ListObjectsV2Input{
+		Bucket: &c.Bucket,
+		Prefix: &pfx,
+	}
+
+	if startAfter != "" {
+		lst.StartAfter = &startAfter
+	}
+
+	if delimiter {
+		lst.Delimiter = aws.String("/")
+	}
+
+	var objs []types.Object
+	pgr := s3.NewListObjectsV2Paginator(c.Service, lst)
+	for pgr.HasMorePages() {
+		pge, err := pgr.NextPage(c.context(), c.apiOptions()...)
+		if err != nil {
+			return nil, err
+		}
+
+		objs = append(objs, pge.Contents...)
+	}
+
+	return objs, nil
+}
+
+// CheckIndexExists checks if a unique index item owned by another record
+// exists in the given collection.
 func (c *Client) CheckIndexExists(ca *ModelCache) error {
+	id := ca.GetModelID()
+
 	for _, index := range ca.IndexFields {
 		if index.CurrentValue == "" {
 			continue
@@ -62,27 +139,29 @@ func (c *Client) CheckIndexExists(ca *ModelCache) error {
 
 		if index.IndexType == UniqueIndex {
 			// Create the pfx path for the index item
-			pfx, err := encodeIndexPrefix(ca.Collection, index.FieldName, index.CurrentValue, index.IndexType)
+			pfx, err := c.indexPrefix(ca.Collection, index, index.CurrentValue)
 			if err != nil {
 				return err
 			}
 
+			// The trailing slash keeps values that extend this one from
+			// matching
 			list := &s3.ListObjectsV2Input{
 				Bucket: &c.Bucket,
-				Prefix: &pfx,
+				Prefix: aws.String(pfx + "/"),
 			}
 
-			res, err := c.Service.ListObjectsV2(context.TODO(), list)
+			res, err := c.Service.ListObjectsV2(c.context(), list, c.apiOptions()...)
 			if err != nil {
 				return err
 			}
 
-			if res.Contents == nil {
-				return nil
-			}
-
-			if len(res.Contents) > 0 {
-				return fmt.Errorf("[Error] CheckIndexExists: index %s with value %s already exists", index.FieldName, index.CurrentValue)
+			// Items owned by the record itself are not conflicts
+			for _, obj := range res.Contents {
+				if *obj.Key != pfx+"/"+id {
+					c.recordConflict("unique")
+					return fmt.Errorf("[Error] CheckIndexExists: %w", &ErrUniqueViolation{Field: index.FieldName, Value: index.CurrentValue})
+				}
 			}
 		}
 	}
@@ -99,20 +178,20 @@ func (c *Client) CreateIndexItems(ca *ModelCache) error {
 			continue
 		}
 
-		log.Printf("CreateIndexItem: collection=%s, indexField=%v", ca.Collection, index)
-
 		// Create the pfx path for the index item
-		pfx, err := encodeIndexPrefix(ca.Collection, index.FieldName, index.CurrentValue, index.IndexType)
+		pfx, err := c.indexPrefix(ca.Collection, index, index.CurrentValue)
 		if err != nil {
 			return err
 		}
 
+		c.logDebug("create index item", "collection", ca.Collection, "key", redactKey(pfx+"/"+id))
+
 		put := &s3.PutObjectInput{
 			Bucket: &c.Bucket,
 			Key:    aws.String(pfx + "/" + id),
 		}
 
-		if _, err := c.Service.PutObject(context.TODO(), put); err != nil {
+		if _, err := c.Service.PutObject(c.context(), put, c.apiOptions()...); err != nil {
 			return err
 		}
 	}
@@ -125,43 +204,45 @@ func (c *Client) UpdateIndexItems(ca *ModelCache) error {
 	id := ca.ModelID.Interface().(ULID).String()
 
 	for _, index := range ca.IndexFields {
-		if index.CurrentValue == "" {
-			continue
-		}
-
 		if index.PreviousValue != "" {
-			log.Printf("UpdateIndexItem: collection=%s, indexField=%v", ca.Collection, index)
-
 			// Create the key path for the old index item
-			oldPfx, err := encodeIndexPrefix(ca.Collection, index.FieldName, index.PreviousValue, index.IndexType)
+			oldPfx, err := c.indexPrefix(ca.Collection, index, index.PreviousValue)
 			if err != nil {
 				return err
 			}
 
+			c.logDebug("delete index item", "collection", ca.Collection, "key", redactKey(oldPfx+"/"+id))
+
 			// Delete the old index item
 			del := &s3.DeleteObjectInput{
 				Bucket: &c.Bucket,
 				Key:    aws.String(oldPfx + "/" + id),
 			}
 
-			if _, err := c.Service.DeleteObject(context.TODO(), del); err != nil {
+			if _, err := c.Service.DeleteObject(c.context(), del, c.apiOptions()...); err != nil {
 				return err
 			}
+		}
 
-			// Create the key path for the new index item
-			newPfx, err := encodeIndexPrefix(ca.Collection, index.FieldName, index.CurrentValue, index.IndexType)
-			if err != nil {
-				return err
-			}
+		if index.CurrentValue == "" {
+			continue
+		}
 
-			put := &s3.PutObjectInput{
-				Bucket: &c.Bucket,
-				Key:    aws.String(newPfx + "/" + id),
-			}
+		// Create the key path for the new index item
+		newPfx, err := c.indexPrefix(ca.Collection, index, index.CurrentValue)
+		if err != nil {
+			return err
+		}
 
-			if _, err := c.Service.PutObject(context.TODO(), put); err != nil {
-				return err
-			}
+		c.logDebug("create index item", "collection", ca.Collection, "key", redactKey(newPfx+"/"+id))
+
+		put := &s3.PutObjectInput{
+			Bucket: &c.Bucket,
+			Key:    aws.String(newPfx + "/" + id),
+		}
+
+		if _, err := c.Service.PutObject(c.context(), put, c.apiOptions()...); err != nil {
+			return err
 		}
 	}
 
@@ -177,21 +258,21 @@ func (c *Client) DeleteIndexItems(ca *ModelCache) error {
 			continue
 		}
 
-		log.Printf("DeleteIndexItem: collection=%s, indexField=%v", ca.Collection, index)
-
 		// Create the pfx path for the index item
-		pfx, err := encodeIndexPrefix(ca.Collection, index.FieldName, index.CurrentValue, index.IndexType)
+		pfx, err := c.indexPrefix(ca.Collection, index, index.CurrentValue)
 		if err != nil {
 			return err
 		}
 
+		c.logDebug("delete index item", "collection", ca.Collection, "key", redactKey(pfx+"/"+id))
+
 		del := &s3.DeleteObjectInput{
 			Bucket: &c.Bucket,
 			Key:    aws.String(pfx + "/" + id),
 		}
 
 		var notFound *types.NotFound
-		_, err = c.Service.DeleteObject(context.TODO(), del)
+		_, err = c.Service.DeleteObject(c.context(), del, c.apiOptions()...)
 		if err != nil && !errors.As(err, &notFound) {
 			return err
 		}
@@ -199,3 +280,85 @@ func (c *Client) DeleteIndexItems(ca *ModelCache) error {
 
 	return nil
 }
+
+// TrashIndexItems moves index items in the given collection to the trash,
+// so they are excluded from queries.
+func (c *Client) TrashIndexItems(ca *ModelCache) error {
+	return c.moveIndexItems(ca, true)
+}
+
+// RestoreIndexItems moves index items in the given collection back from
+// the trash.
+func (c *Client) RestoreIndexItems(ca *ModelCache) error {
+	return c.moveIndexItems(ca, false)
+}
+
+// DeleteTrashItems deletes trashed index items in the given collection.
+func (c *Client) DeleteTrashItems(ca *ModelCache) error {
+	id := ca.GetModelID()
+
+	for _, index := range ca.IndexFields {
+		if index.CurrentValue == "" {
+			continue
+		}
+
+		// Create the pfx path for the index item
+		pfx, err := c.indexPrefix(ca.Collection, index, index.CurrentValue)
+		if err != nil {
+			return err
+		}
+
+		del := &s3.DeleteObjectInput{
+			Bucket: &c.Bucket,
+			Key:    aws.String(encodeTrashKey(pfx + "/" + id)),
+		}
+
+		if _, err := c.Service.DeleteObject(c.context(), del, c.apiOptions()...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// moveIndexItems moves index items between the index and trash paths.
+func (c *Client) moveIndexItems(ca *ModelCache, trash bool) error {
+	id := ca.GetModelID()
+
+	for _, index := range ca.IndexFields {
+		if index.CurrentValue == "" {
+			continue
+		}
+
+		// Create the pfx path for the index item
+		pfx, err := c.indexPrefix(ca.Collection, index, index.CurrentValue)
+		if err != nil {
+			return err
+		}
+
+		src, dst := pfx+"/"+id, encodeTrashKey(pfx+"/"+id)
+		if !trash {
+			src, dst = dst, src
+		}
+
+		put := &s3.PutObjectInput{
+			Bucket: &c.Bucket,
+			Key:    &dst,
+		}
+
+		if _, err := c.Service.PutObject(c.context(), put, c.apiOptions()...); err != nil {
+			return err
+		}
+
+		del := &s3.DeleteObjectInput{
+			Bucket: &c.Bucket,
+			Key:    &src,
+		}
+
+		if _, err := c.Service.DeleteObject(c.context(), del, c.apiOptions()...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
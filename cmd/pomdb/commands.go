@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pomdb/pomdb-go"
+)
+
+// runCollections lists the collections in the bucket.
+func runCollections(ctx context.Context, c *pomdb.Client, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	manifests, err := c.Collections(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range manifests {
+		indexes := 0
+		for _, f := range m.Fields {
+			if f.Index != "" {
+				indexes++
+			}
+		}
+
+		fmt.Printf("%s\tfields=%d\tindexes=%d\tschema=%d\tcodec=%s\n", m.Name, len(m.Fields), indexes, m.SchemaVersion, m.Codec)
+	}
+
+	return nil
+}
+
+// runDescribe prints a collection's manifest.
+func runDescribe(ctx context.Context, c *pomdb.Client, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	m, err := c.Collection(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	return printJSON(m)
+}
+
+// runGet prints a record.
+func runGet(ctx context.Context, c *pomdb.Client, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	m, err := loadModel(ctx, c, args[0])
+	if err != nil {
+		return err
+	}
+
+	record, err := find(ctx, c, m, args[1])
+	if err != nil {
+		return err
+	}
+
+	return printJSON(record)
+}
+
+// runPut creates a record from a json document, read from a file or stdin.
+// Documents with the ID of an existing record update it.
+func runPut(ctx context.Context, c *pomdb.Client, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage
+	}
+
+	m, err := loadModel(ctx, c, args[0])
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if len(args) == 2 && args[1] != "-" {
+		f, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	record := m.new()
+	if err := json.NewDecoder(r).Decode(record); err != nil {
+		return fmt.Errorf("invalid document: %w", err)
+	}
+
+	cc := c.WithContext(ctx)
+	if id := m.id(record); id != new(pomdb.ULID).String() {
+		if _, err := find(ctx, c, m, id); err != nil {
+			return err
+		}
+
+		if _, err := cc.Update(record); err != nil {
+			return err
+		}
+	} else if _, err := cc.Create(record); err != nil {
+		return err
+	}
+
+	return printJSON(record)
+}
+
+// runDelete soft-deletes a record, or purges it with -purge. Whether an
+// application soft-deletes a collection's records is not recorded in its
+// manifest, so records are only removed when asked to.
+func runDelete(ctx context.Context, c *pomdb.Client, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	purge := fs.Bool("purge", false, "permanently delete the record")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 2 {
+		return errUsage
+	}
+
+	m, err := loadModel(ctx, c, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	// Soft-deleted records may still be purged
+	q := pomdb.Query{Model: m.new(), Field: "id", Value: fs.Arg(1), Trashed: pomdb.QueryWithTrashed}
+	record, err := c.WithContext(ctx).FindOne(q)
+	if err != nil {
+		return err
+	}
+
+	if *purge {
+		_, err = c.WithContext(ctx).Purge(record)
+	} else {
+		_, err = c.WithContext(ctx).SoftDelete(record)
+	}
+
+	return err
+}
+
+// runQuery prints the records matching an index query, one json document
+// per line. The token of the next page, if any, is printed to stderr.
+func runQuery(ctx context.Context, c *pomdb.Client, args []string) error {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	limit := fs.Int("limit", pomdb.QueryLimitDefault, "maximum number of records")
+	next := fs.String("next", "", "token of the page to start from")
+	trashed := fs.String("trashed", "exclude", "soft-deleted records to include: exclude, with or only")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 4 {
+		return errUsage
+	}
+
+	m, err := loadModel(ctx, c, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	filters := map[string]pomdb.QueryFilter{
+		"eq": pomdb.QueryEqual,
+		"gt": pomdb.QueryGreaterThan,
+		"lt": pomdb.QueryLessThan,
+	}
+
+	filter, ok := filters[fs.Arg(2)]
+	if !ok {
+		return errUsage
+	}
+
+	modes := map[string]pomdb.QueryTrashed{
+		"exclude": pomdb.QueryExcludeTrashed,
+		"with":    pomdb.QueryWithTrashed,
+		"only":    pomdb.QueryOnlyTrashed,
+	}
+
+	mode, ok := modes[*trashed]
+	if !ok {
+		return errUsage
+	}
+
+	value, err := m.parseValue(fs.Arg(1), fs.Arg(3))
+	if err != nil {
+		return err
+	}
+
+	res, err := c.WithContext(ctx).FindMany(pomdb.Query{
+		Model:     m.new(),
+		Field:     fs.Arg(1),
+		Value:     value,
+		Filter:    filter,
+		Limit:     *limit,
+		NextToken: *next,
+		Trashed:   mode,
+	})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, doc := range res.Docs {
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	}
+
+	if res.NextToken != "" {
+		fmt.Fprintf(os.Stderr, "next: %s\n", res.NextToken)
+	}
+
+	return nil
+}
+
+// runDecode prints the collection, index, value and record of index keys.
+func runDecode(ctx context.Context, c *pomdb.Client, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	for _, key := range args {
+		ik, err := pomdb.ParseIndexKey(key)
+		if err != nil {
+			return err
+		}
+
+		state := "live"
+		if ik.Trashed {
+			state = "trashed"
+		}
+
+		fmt.Printf("collection=%s index=%s field=%s value=%q id=%s state=%s\n", ik.Collection, ik.IndexType, ik.Field, ik.Value, ik.ID, state)
+	}
+
+	return nil
+}
+
+// runVerify checks a collection's records against its index items, and
+// repairs them with -repair. It fails if issues remain.
+func runVerify(ctx context.Context, c *pomdb.Client, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "repair the issues found")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+
+	m, err := loadModel(ctx, c, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	report, err := c.Verify(ctx, m.new())
+	if err != nil {
+		return err
+	}
+
+	for _, is := range report.Issues {
+		fmt.Printf("%s\tfield=%s\tids=%v\t%s\n", is.Kind, is.Field, is.IDs, is.Key)
+	}
+
+	fmt.Printf("records=%d items=%d issues=%d\n", report.Records, report.Items, len(report.Issues))
+
+	if report.OK() {
+		return nil
+	}
+
+	if !*repair {
+		return fmt.Errorf("%d issues found", len(report.Issues))
+	}
+
+	fixed, err := c.Repair(ctx, m.new(), report)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("fixed=%d\n", fixed)
+
+	return nil
+}
+
+// runRebuild rebuilds the index items of a collection.
+func runRebuild(ctx context.Context, c *pomdb.Client, args []string) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+
+	m, err := loadModel(ctx, c, args[0])
+	if err != nil {
+		return err
+	}
+
+	report, err := c.RebuildIndexes(ctx, m.new(), args[1:]...)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(report)
+}
+
+// runPurgeTrash purges the soft-deleted records of a collection.
+func runPurgeTrash(ctx context.Context, c *pomdb.Client, args []string) error {
+	fs := flag.NewFlagSet("purge-trash", flag.ContinueOnError)
+	olderThan := fs.Duration("older-than", 0, "only purge records deleted at least this long ago")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+
+	m, err := loadModel(ctx, c, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	n, err := c.PurgeTrashed(ctx, m.new(), *olderThan)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("purged=%d\n", n)
+
+	return nil
+}
+
+// runExport writes the records of a collection to a file or stdout.
+func runExport(ctx context.Context, c *pomdb.Client, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	trashed := fs.Bool("trashed", false, "include soft-deleted records")
+	metadata := fs.Bool("metadata", false, "include the stored metadata of records")
+	if err := fs.Parse(args); err != nil || fs.NArg() < 1 || fs.NArg() > 2 {
+		return errUsage
+	}
+
+	m, err := loadModel(ctx, c, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if fs.NArg() == 2 && fs.Arg(1) != "-" {
+		f, err := os.Create(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	bw := bufio.NewWriter(w)
+	n, err := c.Export(ctx, m.new(), bw, pomdb.ExportOptions{WithTrashed: *trashed, WithMetadata: *metadata})
+	if err != nil {
+		return err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "exported=%d\n", n)
+
+	return nil
+}
+
+// runImport imports the records of an export from a file or stdin.
+func runImport(ctx context.Context, c *pomdb.Client, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "check the records without writing them")
+	onConflict := fs.String("on-conflict", "skip", "treatment of conflicting records: skip, overwrite or fail")
+	if err := fs.Parse(args); err != nil || fs.NArg() < 1 || fs.NArg() > 2 {
+		return errUsage
+	}
+
+	policies := map[string]pomdb.ImportConflictPolicy{
+		"skip":      pomdb.ImportSkip,
+		"overwrite": pomdb.ImportOverwrite,
+		"fail":      pomdb.ImportFail,
+	}
+
+	policy, ok := policies[*onConflict]
+	if !ok {
+		return errUsage
+	}
+
+	var r io.Reader = os.Stdin
+	if fs.NArg() == 2 && fs.Arg(1) != "-" {
+		f, err := os.Open(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	// Collections missing from the bucket are registered from the
+	// export's manifest, on its first line
+	br := bufio.NewReader(r)
+	first, err := br.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	r = io.MultiReader(bytes.NewReader(first), br)
+
+	m, err := loadModel(ctx, c, fs.Arg(0))
+	if errors.Is(err, pomdb.ErrNotFound) && !*dryRun {
+		m, err = registerModel(ctx, c, fs.Arg(0), first)
+	}
+	if err != nil {
+		return err
+	}
+
+	report, err := c.Import(ctx, m.new(), r, pomdb.ImportOptions{DryRun: *dryRun, OnConflict: policy})
+	if report != nil {
+		for _, conflict := range report.Conflicts {
+			fmt.Printf("conflict\tline=%d\tid=%s\t%s\n", conflict.Line, conflict.ID, conflict.Reason)
+		}
+
+		fmt.Printf("created=%d updated=%d skipped=%d\n", report.Created, report.Updated, report.Skipped)
+	}
+
+	return err
+}
+
+// runSnapshot takes a snapshot of the bucket's collections.
+func runSnapshot(ctx context.Context, c *pomdb.Client, args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	toBucket := fs.String("to-bucket", "", "bucket to store the snapshot in, instead of the source bucket")
+	prefix := fs.String("prefix", "", "prefix to store the snapshot under")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	sm, err := c.Snapshot(ctx, pomdb.SnapshotLocation{Bucket: *toBucket, Prefix: *prefix})
+	if err != nil {
+		return err
+	}
+
+	return printJSON(sm)
+}
+
+// runSnapshots lists the snapshots stored in the bucket.
+func runSnapshots(ctx context.Context, c *pomdb.Client, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	snapshots, err := c.Snapshots(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, sm := range snapshots {
+		fmt.Printf("%s\t%s\tcollections=%d\tobjects=%d\tchanged=%d\n", sm.Location.Prefix, time.Time(sm.StartedAt).UTC().Format(time.RFC3339), len(sm.Collections), sm.Objects, sm.Changed)
+	}
+
+	return nil
+}
+
+// runRestore restores the bucket's collections from a snapshot.
+func runRestore(ctx context.Context, c *pomdb.Client, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fromBucket := fs.String("from-bucket", "", "bucket the snapshot is stored in, instead of the target bucket")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+
+	sm, err := c.RestoreSnapshot(ctx, pomdb.SnapshotLocation{Bucket: *fromBucket, Prefix: fs.Arg(0)})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("restored %s, taken %s\n", sm.ID, time.Time(sm.StartedAt).UTC().Format(time.RFC3339))
+
+	return nil
+}
+
+// runChanges prints the entries of a collection's changelog after a cursor,
+// one json document per line. The cursor to continue from is printed to
+// stderr.
+func runChanges(ctx context.Context, c *pomdb.Client, args []string) error {
+	fs := flag.NewFlagSet("changes", flag.ContinueOnError)
+	since := fs.String("since", "", "cursor to read the entries after")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+
+	m, err := loadModel(ctx, c, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	feed, err := c.Changes(ctx, m.new(), *since)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, ch := range feed.Changes {
+		entry := struct {
+			ID        string          `json:"id"`
+			Op        pomdb.ChangeOp  `json:"op"`
+			RecordID  string          `json:"record_id"`
+			Timestamp pomdb.Timestamp `json:"timestamp"`
+			Record    interface{}     `json:"record,omitempty"`
+		}{ch.ID, ch.Op, ch.RecordID, ch.Timestamp, ch.Doc}
+
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "cursor: %s\n", feed.Cursor)
+
+	return nil
+}
+
+// find returns the record of a model with the given ID.
+func find(ctx context.Context, c *pomdb.Client, m *model, id string) (interface{}, error) {
+	record, err := c.WithContext(ctx).FindOne(pomdb.Query{Model: m.new(), Field: "id", Value: id})
+	if errors.Is(err, pomdb.ErrNotFound) {
+		return nil, fmt.Errorf("no record %s in collection %s", id, m.manifest.Name)
+	}
+
+	return record, err
+}
+
+// printJSON prints a value as indented json.
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,181 @@
+// Command pomdb inspects and administers PomDB buckets.
+//
+// Usage:
+//
+//	pomdb [flags] <command> [arguments]
+//
+// The commands are:
+//
+//	collections                              list the collections in the bucket
+//	describe <collection>                    print a collection's manifest
+//	get <collection> <id>                    print a record
+//	put <collection> [file]                  create or update a record from json
+//	delete [-purge] <collection> <id>        soft-delete or purge a record
+//	query <collection> <field> <op> <value>  find records by index
+//	decode <key>...                          decode index keys
+//	verify [-repair] <collection>            check records against index items
+//	rebuild <collection> [field...]          rebuild index items
+//	purge-trash [-older-than d] <collection> purge soft-deleted records
+//	export <collection> [file]               export records as JSON Lines
+//	import <collection> [file]               import records from JSON Lines
+//	snapshot [-to-bucket b] [-prefix p]      take a snapshot of the bucket
+//	snapshots                                list the snapshots in the bucket
+//	restore [-from-bucket b] <prefix>        restore a snapshot
+//	changes [-since cursor] <collection>     print a collection's changelog
+//
+// Records are interpreted with the collections' manifests, so only
+// collections registered by a client are available. The bucket is read from
+// S3, or from a local directory with -dir.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pomdb/pomdb-go"
+	"github.com/pomdb/pomdb-go/local"
+)
+
+// command is a subcommand of the tool.
+type command struct {
+	usage  string
+	writes bool
+	run    func(ctx context.Context, c *pomdb.Client, args []string) error
+}
+
+var commands = map[string]command{
+	"collections": {usage: "collections", run: runCollections},
+	"describe":    {usage: "describe <collection>", run: runDescribe},
+	"get":         {usage: "get <collection> <id>", run: runGet},
+	"put":         {usage: "put <collection> [file]", writes: true, run: runPut},
+	"delete":      {usage: "delete [-purge] <collection> <id>", run: runDelete},
+	"query":       {usage: "query [-limit n] [-next token] [-trashed exclude|with|only] <collection> <field> <eq|gt|lt> <value>", run: runQuery},
+	"decode":      {usage: "decode <key>...", run: runDecode},
+	"verify":      {usage: "verify [-repair] <collection>", run: runVerify},
+	"rebuild":     {usage: "rebuild <collection> [field...]", run: runRebuild},
+	"purge-trash": {usage: "purge-trash [-older-than duration] <collection>", run: runPurgeTrash},
+	"export":      {usage: "export [-trashed] [-metadata] <collection> [file]", run: runExport},
+	"import":      {usage: "import [-dry-run] [-on-conflict skip|overwrite|fail] <collection> [file]", writes: true, run: runImport},
+	"snapshot":    {usage: "snapshot [-to-bucket bucket] [-prefix prefix]", run: runSnapshot},
+	"snapshots":   {usage: "snapshots", run: runSnapshots},
+	"restore":     {usage: "restore [-from-bucket bucket] <prefix>", run: runRestore},
+	"changes":     {usage: "changes [-since cursor] <collection>", run: runChanges},
+}
+
+// errUsage reports that a command was called with invalid arguments.
+var errUsage = errors.New("invalid arguments")
+
+var (
+	bucket   = flag.String("bucket", env("POMDB_BUCKET", "pomdb"), "name of the bucket")
+	region   = flag.String("region", env("AWS_REGION", "us-east-1"), "region of the bucket")
+	endpoint = flag.String("endpoint", os.Getenv("POMDB_ENDPOINT"), "endpoint of an S3-compatible service")
+	dir      = flag.String("dir", os.Getenv("POMDB_DIR"), "local directory to read the bucket from, instead of S3")
+	verbose  = flag.Bool("v", false, "log the client's activity")
+)
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "pomdb: unknown command %s\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Index keys are decoded without a bucket
+	var c *pomdb.Client
+	if flag.Arg(0) != "decode" {
+		var err error
+		if c, err = newClient(ctx, cmd.writes); err != nil {
+			fmt.Fprintf(os.Stderr, "pomdb: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	err := cmd.run(ctx, c, flag.Args()[1:])
+	if errors.Is(err, errUsage) {
+		fmt.Fprintf(os.Stderr, "usage: pomdb %s\n", cmd.usage)
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "pomdb: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// usage prints the tool's usage.
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: pomdb [flags] <command> [arguments]\n\ncommands:\n")
+	for _, name := range []string{"collections", "describe", "get", "put", "delete", "query", "decode", "verify", "rebuild", "purge-trash", "export", "import", "snapshot", "snapshots", "restore", "changes"} {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nflags:\n")
+	flag.PrintDefaults()
+}
+
+// newClient returns a client of the configured bucket. The directory of a
+// local bucket is created for commands that write to it.
+func newClient(ctx context.Context, writes bool) (*pomdb.Client, error) {
+	c := &pomdb.Client{
+		Bucket: *bucket,
+		Region: *region,
+	}
+
+	if *verbose {
+		c.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+
+	if *dir != "" {
+		if writes {
+			if err := local.CreateBucket(*dir, *bucket); err != nil {
+				return nil, err
+			}
+		}
+
+		c.Service = local.NewService(*dir)
+	} else {
+		conf, err := config.LoadDefaultConfig(ctx, config.WithRegion(*region))
+		if err != nil {
+			return nil, err
+		}
+
+		c.Service = s3.NewFromConfig(conf, func(o *s3.Options) {
+			if *endpoint != "" {
+				o.BaseEndpoint = aws.String(*endpoint)
+				o.UsePathStyle = true
+			}
+		})
+	}
+
+	if err := c.WithContext(ctx).CheckBucket(); err != nil {
+		return nil, fmt.Errorf("bucket %s is not accessible: %w", *bucket, err)
+	}
+
+	return c, nil
+}
+
+// env returns the value of an environment variable, or def if it is unset.
+func env(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+
+	return def
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pomdb/pomdb-go"
+)
+
+// fieldTypes are the Go types of the field types in collection manifests.
+var fieldTypes = map[string]reflect.Type{
+	"string":    reflect.TypeOf(""),
+	"int":       reflect.TypeOf(int64(0)),
+	"uint":      reflect.TypeOf(uint64(0)),
+	"float":     reflect.TypeOf(float64(0)),
+	"bool":      reflect.TypeOf(false),
+	"ulid":      reflect.TypeOf(pomdb.ULID{}),
+	"timestamp": reflect.TypeOf(pomdb.Timestamp{}),
+	"time":      reflect.TypeOf(time.Time{}),
+	"bytes":     reflect.TypeOf([]byte(nil)),
+	"array":     reflect.TypeOf([]interface{}(nil)),
+	"object":    reflect.TypeOf((*interface{})(nil)).Elem(),
+}
+
+// model is a collection whose records are built from its manifest.
+type model struct {
+	manifest *pomdb.CollectionManifest
+	typ      reflect.Type
+}
+
+// loadModel returns the model of the named collection, registered with the
+// options of its manifest, so records are written as the collection's
+// clients write them.
+func loadModel(ctx context.Context, c *pomdb.Client, name string) (*model, error) {
+	m, err := c.Collection(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return newModel(ctx, c, m)
+}
+
+// registerModel registers the named collection from the manifest held by
+// the first line of an export, and returns its model.
+func registerModel(ctx context.Context, c *pomdb.Client, name string, line []byte) (*model, error) {
+	var entry pomdb.ExportRecord
+	if err := json.Unmarshal(line, &entry); err != nil || entry.Manifest == nil {
+		return nil, fmt.Errorf("collection %s has no manifest, and the export holds none", name)
+	}
+
+	m := entry.Manifest
+	if m.Name != name {
+		return nil, fmt.Errorf("the export holds collection %s, not %s", m.Name, name)
+	}
+
+	return newModel(ctx, c, m)
+}
+
+// newModel builds the model of a collection from its manifest, and
+// registers it with the manifest's options.
+func newModel(ctx context.Context, c *pomdb.Client, m *pomdb.CollectionManifest) (*model, error) {
+	typ, err := modelType(m)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := pomdb.CollectionOptions{
+		History:     m.History,
+		Changelog:   m.Changelog,
+		TTL:         time.Duration(m.TTL) * time.Second,
+		Compression: m.Compression,
+	}
+
+	for _, codec := range []pomdb.Codec{pomdb.CodecJSON, pomdb.CodecMsgpack, pomdb.CodecCBOR} {
+		if codec.ContentType() == m.Codec {
+			opts.Codec = codec
+		}
+	}
+
+	mdl := &model{manifest: m, typ: typ}
+	if err := c.WithContext(ctx).Register(mdl.new(), opts); err != nil {
+		return nil, err
+	}
+
+	return mdl, nil
+}
+
+// modelType builds a struct type for the records of a collection, with the
+// tags a model of the collection would have. The collection is named on the
+// ID field, as the type itself has no name.
+func modelType(m *pomdb.CollectionManifest) (reflect.Type, error) {
+	var fields []reflect.StructField
+	hasID := false
+
+	for i, f := range m.Fields {
+		typ, ok := fieldTypes[f.Type]
+		if !ok {
+			return nil, fmt.Errorf("collection %s: field %s has unknown type %s", m.Name, f.Name, f.Type)
+		}
+
+		var tags []string
+		if f.Role != "" {
+			tags = append(tags, f.Role)
+		}
+		if f.Role == "id" {
+			tags = append(tags, "collection="+m.Name)
+			hasID = true
+		}
+		if f.Index != "" {
+			tags = append(tags, "index")
+		}
+		if f.Index == "unique" || f.Index == "ranged" {
+			tags = append(tags, f.Index)
+		}
+		if f.Encrypted {
+			tags = append(tags, "encrypted")
+		}
+
+		fields = append(fields, reflect.StructField{
+			Name: "F" + strconv.Itoa(i),
+			Type: typ,
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:%q pomdb:%q`, f.Name, strings.Join(tags, ","))),
+		})
+	}
+
+	if !hasID {
+		return nil, fmt.Errorf("collection %s has no id field", m.Name)
+	}
+
+	return reflect.StructOf(fields), nil
+}
+
+// new returns a pointer to a new record of the model.
+func (m *model) new() interface{} {
+	return reflect.New(m.typ).Interface()
+}
+
+// field returns the manifest of the named field.
+func (m *model) field(name string) (*pomdb.FieldManifest, error) {
+	for _, f := range m.manifest.Fields {
+		if f.Name == name {
+			return &f, nil
+		}
+	}
+
+	return nil, fmt.Errorf("collection %s has no field %s", m.manifest.Name, name)
+}
+
+// id returns the ID of a record of the model.
+func (m *model) id(record interface{}) string {
+	rv := reflect.ValueOf(record).Elem()
+	for i, f := range m.manifest.Fields {
+		if f.Role == "id" {
+			return rv.Field(i).Interface().(pomdb.ULID).String()
+		}
+	}
+
+	return ""
+}
+
+// parseValue parses a value of the named field from its text form, as the
+// field's Go type. Timestamps are given in Unix seconds.
+func (m *model) parseValue(name, s string) (interface{}, error) {
+	f, err := m.field(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch f.Type {
+	case "string":
+		return s, nil
+	case "int":
+		return strconv.ParseInt(s, 10, 64)
+	case "uint":
+		return strconv.ParseUint(s, 10, 64)
+	case "float":
+		return strconv.ParseFloat(s, 64)
+	case "timestamp":
+		unix, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return pomdb.Timestamp(time.Unix(unix, 0)), nil
+	}
+
+	return nil, fmt.Errorf("field %s of type %s cannot be queried", name, f.Type)
+}
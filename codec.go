@@ -0,0 +1,120 @@
+package pomdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec serializes records. Records are stored with the codec's content
+// type, so they are decoded with the codec they were written with.
+type Codec interface {
+	// ContentType returns the media type of serialized records.
+	ContentType() string
+
+	// Marshal serializes a value.
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal deserializes data into the value pointed to by v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Built-in codecs. Model fields are named by their json tags in every
+// codec.
+var (
+	CodecJSON    Codec = jsonCodec{}
+	CodecMsgpack Codec = msgpackCodec{}
+	CodecCBOR    Codec = cborCodec{}
+)
+
+// metaContentType is the metadata key of the content type a record body was
+// serialized with.
+const metaContentType = "pomdb-content-type"
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+type cborCodec struct{}
+
+func (cborCodec) ContentType() string { return "application/cbor" }
+
+func (cborCodec) Marshal(v interface{}) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+func (cborCodec) Unmarshal(data []byte, v interface{}) error {
+	return cbor.Unmarshal(data, v)
+}
+
+// codec returns the codec records of the given collection are written with.
+func (c *Client) codec(collection string) Codec {
+	if codec := c.options(collection).Codec; codec != nil {
+		return codec
+	}
+
+	if c.Codec != nil {
+		return c.Codec
+	}
+
+	return CodecJSON
+}
+
+// codecFor returns the codec of the given content type, falling back to
+// json for records stored without one.
+func (c *Client) codecFor(collection, contentType string) Codec {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return CodecJSON
+	}
+
+	for _, codec := range []Codec{c.options(collection).Codec, c.Codec, CodecJSON, CodecMsgpack, CodecCBOR} {
+		if codec != nil && codec.ContentType() == mt {
+			return codec
+		}
+	}
+
+	return CodecJSON
+}
+
+// decodeDocument deserializes a record into its generic document form.
+// Json numbers are kept as json.Number, so integers do not lose precision.
+func decodeDocument(codec Codec, data []byte, doc *map[string]interface{}) error {
+	if _, ok := codec.(jsonCodec); ok {
+		return decodeNumbers(data, doc)
+	}
+
+	return codec.Unmarshal(data, doc)
+}
@@ -0,0 +1,115 @@
+package pomdb_test
+
+import (
+	"testing"
+
+	"github.com/pomdb/pomdb-go"
+)
+
+type benchRecord struct {
+	pomdb.Model
+	Name    string            `json:"name" pomdb:"index"`
+	Email   string            `json:"email" pomdb:"index,unique"`
+	Age     int               `json:"age" pomdb:"index,ranged"`
+	Score   float64           `json:"score"`
+	Active  bool              `json:"active"`
+	Tags    []string          `json:"tags"`
+	Profile map[string]string `json:"profile"`
+}
+
+var benchCodecs = []struct {
+	name  string
+	codec pomdb.Codec
+}{
+	{"JSON", pomdb.CodecJSON},
+	{"Msgpack", pomdb.CodecMsgpack},
+	{"CBOR", pomdb.CodecCBOR},
+}
+
+func newBenchRecord() *benchRecord {
+	return &benchRecord{
+		Model: pomdb.Model{
+			ID:        pomdb.NewULID(),
+			CreatedAt: pomdb.NewTimestamp(),
+			UpdatedAt: pomdb.NewTimestamp(),
+		},
+		Name:   "Ada Lovelace",
+		Email:  "ada@example.com",
+		Age:    36,
+		Score:  98.6,
+		Active: true,
+		Tags:   []string{"mathematics", "computing", "poetry"},
+		Profile: map[string]string{
+			"city":    "London",
+			"country": "United Kingdom",
+			"title":   "Countess of Lovelace",
+		},
+	}
+}
+
+// BenchmarkMarshal reports the time to encode a record with each codec, and
+// the size of the encoded record.
+func BenchmarkMarshal(b *testing.B) {
+	rec := newBenchRecord()
+
+	for _, bc := range benchCodecs {
+		b.Run(bc.name, func(b *testing.B) {
+			var enc []byte
+			var err error
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if enc, err = bc.codec.Marshal(rec); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportMetric(float64(len(enc)), "bytes/record")
+		})
+	}
+}
+
+// BenchmarkUnmarshal reports the time to decode a record with each codec.
+func BenchmarkUnmarshal(b *testing.B) {
+	rec := newBenchRecord()
+
+	for _, bc := range benchCodecs {
+		b.Run(bc.name, func(b *testing.B) {
+			enc, err := bc.codec.Marshal(rec)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var out benchRecord
+				if err := bc.codec.Unmarshal(enc, &out); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportMetric(float64(len(enc)), "bytes/record")
+		})
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	rec := newBenchRecord()
+
+	for _, bc := range benchCodecs {
+		enc, err := bc.codec.Marshal(rec)
+		if err != nil {
+			t.Fatalf("%s: %v", bc.name, err)
+		}
+
+		var out benchRecord
+		if err := bc.codec.Unmarshal(enc, &out); err != nil {
+			t.Fatalf("%s: %v", bc.name, err)
+		}
+
+		if out.ID != rec.ID || out.Email != rec.Email || out.Profile["city"] != rec.Profile["city"] || len(out.Tags) != len(rec.Tags) {
+			t.Errorf("%s: decoded %+v, want %+v", bc.name, out, *rec)
+		}
+	}
+}
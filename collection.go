@@ -0,0 +1,80 @@
+package pomdb
+
+import (
+	"time"
+)
+
+// CollectionOptions configures the behaviour of a single collection.
+type CollectionOptions struct {
+	// History keeps a copy of every version of the collection's records.
+	History bool
+
+	// Changelog appends an entry to the collection's changelog for every
+	// change to its records, which is read with Changes.
+	Changelog bool
+
+	// TTL expires the collection's records once they are older than the
+	// given duration. Records may also expire earlier through a ttl field.
+	TTL time.Duration
+
+	// Compression compresses the bodies of the collection's records.
+	// Records are decompressed according to how they were stored, so
+	// changing it does not affect existing records.
+	Compression Compression
+
+	// Codec serializes the collection's records, in place of the client's
+	// codec.
+	Codec Codec
+
+	// Migrations rewrite the collection's records to new schema versions,
+	// and are applied by Migrate.
+	Migrations []Migration
+}
+
+// Register sets the options of the model's collection, and writes the
+// collection's manifest. Models registered before the client is connected
+// have their manifests written by Connect. Register is not safe for
+// concurrent use, and should be called before the client is used.
+func (c *Client) Register(model interface{}, opts CollectionOptions) error {
+	// Dereference the input
+	rv, err := dereferenceStruct(model)
+	if err != nil {
+		return err
+	}
+
+	// Build the struct cache
+	ca := NewModelCache(rv)
+
+	if c.collections == nil {
+		c.collections = make(map[string]CollectionOptions)
+	}
+
+	if c.models == nil {
+		c.models = make(map[string]*ModelCache)
+	}
+
+	c.collections[ca.Collection] = opts
+	c.models[ca.Collection] = ca
+
+	if c.Service == nil {
+		return nil
+	}
+
+	return c.writeManifest(ca)
+}
+
+// writeManifests writes the manifests of the registered collections.
+func (c *Client) writeManifests() error {
+	for _, ca := range c.models {
+		if err := c.writeManifest(ca); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// options returns the options registered for the given collection.
+func (c *Client) options(collection string) CollectionOptions {
+	return c.collections[collection]
+}
@@ -0,0 +1,102 @@
+package pomdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is an algorithm that compresses record bodies.
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// metaCompression is the metadata key of the algorithm a record body was
+// compressed with.
+const metaCompression = "pomdb-compression"
+
+// zstd encoders and decoders are safe for concurrent use, and expensive to
+// create, so they are shared.
+var (
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) { return zstd.NewWriter(nil) })
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) { return zstd.NewReader(nil) })
+)
+
+// recordCompression returns the algorithm a fetched record was compressed
+// with, from its metadata or content encoding.
+func recordCompression(doc *s3.GetObjectOutput) Compression {
+	if comp, ok := doc.Metadata[metaCompression]; ok {
+		return Compression(comp)
+	}
+
+	if doc.ContentEncoding != nil {
+		switch comp := Compression(*doc.ContentEncoding); comp {
+		case CompressionGzip, CompressionZstd:
+			return comp
+		}
+	}
+
+	return CompressionNone
+}
+
+// compress compresses b with the given algorithm.
+func compress(comp Compression, b []byte) ([]byte, error) {
+	switch comp {
+	case CompressionNone:
+		return b, nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(b); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		enc, err := zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return enc.EncodeAll(b, nil), nil
+	}
+
+	return nil, fmt.Errorf("[Error] compress: unsupported compression %s", comp)
+}
+
+// decompress decompresses b with the given algorithm.
+func decompress(comp Compression, b []byte) ([]byte, error) {
+	switch comp {
+	case CompressionNone:
+		return b, nil
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("[Error] decompress: %w", err)
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	case CompressionZstd:
+		dec, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		out, err := dec.DecodeAll(b, nil)
+		if err != nil {
+			return nil, fmt.Errorf("[Error] decompress: %w", err)
+		}
+		return out, nil
+	}
+
+	return nil, fmt.Errorf("[Error] decompress: unsupported compression %s", comp)
+}
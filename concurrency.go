@@ -0,0 +1,68 @@
+package pomdb
+
+import (
+	"sync"
+)
+
+// ConcurrencyDefault is the number of objects bulk operations, such as
+// RebuildIndexes, process at once when Client.Concurrency is not set.
+const ConcurrencyDefault int = 8
+
+// concurrency returns the number of objects bulk operations process at once.
+func (c *Client) concurrency() int {
+	if c.Concurrency > 0 {
+		return c.Concurrency
+	}
+
+	return ConcurrencyDefault
+}
+
+// forEach calls fn for every index below n, running up to the client's
+// concurrency at once. It stops starting calls after the first error, or
+// once the client's context is done, and returns that error.
+func (c *Client) forEach(n int, fn func(i int) error) error {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		first error
+	)
+
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if first == nil {
+			first = err
+		}
+	}
+
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return first != nil
+	}
+
+	sem := make(chan struct{}, c.concurrency())
+	for i := 0; i < n && !failed(); i++ {
+		if err := c.context().Err(); err != nil {
+			fail(err)
+			break
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := fn(i); err != nil {
+				fail(err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	return first
+}
@@ -1,15 +1,18 @@
 package pomdb
 
 import (
-	"bytes"
-	"context"
-	"encoding/json"
-
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"reflect"
 )
 
 // Create creates a record in the database
 func (c *Client) Create(i interface{}) (*string, error) {
+	return c.invokeETag(&Operation{Name: "Create", Model: i}, func(c *Client, op *Operation) (interface{}, error) {
+		return c.create(op.Model)
+	})
+}
+
+// create implements Create.
+func (c *Client) create(i interface{}) (*string, error) {
 	// Dereference the input
 	rv, err := dereferenceStruct(i)
 	if err != nil {
@@ -22,11 +25,21 @@ func (c *Client) Create(i interface{}) (*string, error) {
 	// Set the new model fields
 	ca.SetManagedFields()
 
-	// Get the model ID
-	id := ca.GetModelID()
+	return c.createRecord(ca, i)
+}
+
+// createRecord writes the indexes and data of a new record.
+func (c *Client) createRecord(ca *ModelCache, i interface{}) (*string, error) {
+	if err := runHook(c.context(), i, beforeCreate); err != nil {
+		return nil, err
+	}
 
-	// Get the collection
-	co := ca.Collection
+	// Rebuild the struct cache, as the hook may change indexed fields
+	ca = NewModelCache(reflect.ValueOf(i).Elem())
+
+	if err := Validate(i); err != nil {
+		return nil, err
+	}
 
 	if len(ca.IndexFields) > 0 {
 		if err := c.CheckIndexExists(ca); err != nil {
@@ -38,26 +51,18 @@ func (c *Client) Create(i interface{}) (*string, error) {
 		}
 	}
 
-	// Encode the object
-	enc, err := json.Marshal(i)
+	res, err := c.putRecord(ca, i)
 	if err != nil {
 		return nil, err
 	}
 
-	// Set the record's key
-	key := co + "/" + id
-
-	put := &s3.PutObjectInput{
-		Bucket: &c.Bucket,
-		Key:    &key,
-		Body:   bytes.NewReader(enc),
+	if err := c.appendChange(ca, ChangeCreate, i); err != nil {
+		return nil, err
 	}
 
-	// Set the record's data
-	res, err := c.Service.PutObject(context.TODO(), put)
-	if err != nil {
+	if err := runHook(c.context(), i, afterCreate); err != nil {
 		return nil, err
 	}
 
-	return res.ETag, nil
+	return res, nil
 }
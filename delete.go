@@ -1,7 +1,9 @@
 package pomdb
 
 import (
-	"context"
+	"errors"
+	"fmt"
+	"reflect"
 	"strconv"
 	"time"
 
@@ -12,16 +14,36 @@ import (
 
 // Delete deletes a record and its indexes from the database.
 func (c *Client) Delete(i interface{}) (*string, error) {
-	if c.SoftDeletes {
-		return c.SoftDelete(i)
-	}
+	return c.invokeETag(&Operation{Name: "Delete", Model: i}, func(c *Client, op *Operation) (interface{}, error) {
+		if c.SoftDeletes {
+			return c.softDelete(op.Model)
+		}
 
+		return c.purge(op.Model)
+	})
+}
+
+// SoftDelete soft deletes a record and its indexes from the database. The
+// record's deletion time is stored with it, and its index items are moved
+// to the trash so the record is excluded from queries.
+func (c *Client) SoftDelete(i interface{}) (*string, error) {
+	return c.invokeETag(&Operation{Name: "SoftDelete", Model: i}, func(c *Client, op *Operation) (interface{}, error) {
+		return c.softDelete(op.Model)
+	})
+}
+
+// softDelete implements SoftDelete.
+func (c *Client) softDelete(i interface{}) (*string, error) {
 	// Dereference the input
 	rv, err := dereferenceStruct(i)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := runHook(c.context(), i, beforeDelete); err != nil {
+		return nil, err
+	}
+
 	// Build the struct cache
 	ca := NewModelCache(rv)
 
@@ -31,71 +53,140 @@ func (c *Client) Delete(i interface{}) (*string, error) {
 	// Get the collection
 	co := ca.Collection
 
-	// Check indexes
-	if len(ca.IndexFields) > 0 {
-		if err := c.DeleteIndexItems(ca); err != nil {
+	// Get the stored record
+	prev, _, err := c.getRecord(ca, co+"/"+id)
+	if err != nil {
+		return nil, err
+	}
+
+	pc := NewModelCache(reflect.ValueOf(prev).Elem())
+
+	trashed, err := c.isTrashed(pc)
+	if err != nil {
+		return nil, err
+	}
+
+	if !trashed {
+		// Set the record's deletion time
+		pc.SetDeletedAt()
+		if _, err := c.putRecord(pc, prev); err != nil {
 			return nil, err
 		}
-	}
 
-	// Set the record's key
-	key := co + "/" + id
+		// Move indexes to the trash
+		if len(pc.IndexFields) > 0 {
+			if err := c.TrashIndexItems(pc); err != nil {
+				return nil, err
+			}
+		}
 
-	// Use s3 to delete the record
-	del := &s3.DeleteObjectInput{
-		Bucket: &c.Bucket,
-		Key:    &key,
+		// Mark the record as trashed
+		put := &s3.PutObjectInput{
+			Bucket: &c.Bucket,
+			Key:    aws.String(encodeTrashMarker(co, id)),
+		}
+
+		if _, err := c.Service.PutObject(c.context(), put, c.apiOptions()...); err != nil {
+			return nil, err
+		}
+
+		if err := c.appendChange(pc, ChangeDelete, prev); err != nil {
+			return nil, err
+		}
 	}
 
-	// Delete the record's data
-	_, err = c.Service.DeleteObject(context.TODO(), del)
-	if err != nil {
+	// Reflect the deletion time in the model
+	if ca.DeletedAt != nil && ca.DeletedAt.CanSet() && pc.DeletedAt != nil {
+		ca.DeletedAt.Set(*pc.DeletedAt)
+	}
+
+	if err := runHook(c.context(), i, afterDelete); err != nil {
 		return nil, err
 	}
 
 	return &id, nil
 }
 
-// SoftDelete soft deletes a record and its indexes from the database.
-func (c *Client) SoftDelete(i interface{}) (*string, error) {
-	// Dereference the input
-	rv, err := dereferenceStruct(i)
-	if err != nil {
-		return nil, err
+// isTrashed reports whether a stored record is soft-deleted. Records without
+// a deleted_at field are checked for a trash marker.
+func (c *Client) isTrashed(ca *ModelCache) (bool, error) {
+	if ca.DeletedAt != nil {
+		return ca.IsDeleted(), nil
 	}
 
-	// Build the struct cache
-	ca := NewModelCache(rv)
-
-	// Get the model ID
-	id := ca.GetModelID()
+	head := &s3.HeadObjectInput{
+		Bucket: &c.Bucket,
+		Key:    aws.String(encodeTrashMarker(ca.Collection, ca.GetModelID())),
+	}
 
-	// Get the collection
-	co := ca.Collection
+	var notFound *types.NotFound
+	_, err := c.Service.HeadObject(c.context(), head, c.apiOptions()...)
+	if err != nil && errors.As(err, &notFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
 
-	// Set the record's key
-	key := co + "/" + id
+	return true, nil
+}
 
-	// Create a deletion timestamp in seconds
-	ts := strconv.FormatInt(time.Now().Unix(), 10)
+// legacyDeletedAt returns the deletion time of a record soft-deleted by
+// earlier versions of PomDB, which tagged the record with DeletedAt instead
+// of writing a trash marker. RebuildIndexes converts such records. Only
+// clients with soft deletes enabled wrote the tag.
+func (c *Client) legacyDeletedAt(key string) (Timestamp, bool, error) {
+	if !c.SoftDeletes {
+		return Timestamp{}, false, nil
+	}
 
-	// Add the `DeletedAt` tag to the record
-	put := &s3.PutObjectTaggingInput{
+	get := &s3.GetObjectTaggingInput{
 		Bucket: &c.Bucket,
 		Key:    &key,
-		Tagging: &types.Tagging{
-			TagSet: []types.Tag{
-				{
-					Key:   aws.String("DeletedAt"),
-					Value: aws.String(ts),
-				},
-			},
-		},
 	}
 
-	if _, err := c.Service.PutObjectTagging(context.TODO(), put); err != nil {
-		return nil, err
+	res, err := c.Service.GetObjectTagging(c.context(), get, c.apiOptions()...)
+	if err != nil && apiErrorCode(err) == "NotImplemented" {
+		return Timestamp{}, false, nil
+	} else if err != nil {
+		return Timestamp{}, false, err
 	}
 
-	return &id, nil
+	for _, t := range res.TagSet {
+		if aws.ToString(t.Key) != "DeletedAt" {
+			continue
+		}
+
+		ts, err := strconv.ParseInt(aws.ToString(t.Value), 10, 64)
+		if err != nil {
+			return Timestamp{}, false, fmt.Errorf("[Error] legacyDeletedAt: invalid DeletedAt tag on %s: %w", key, err)
+		}
+
+		return Timestamp(time.Unix(ts, 0)), true, nil
+	}
+
+	return Timestamp{}, false, nil
+}
+
+// convertLegacyTrash stores the deletion time of a record soft-deleted by
+// earlier versions of PomDB, which also drops its DeletedAt tag, and marks
+// it as trashed. Its index items are moved to the trash by the rebuild.
+func (c *Client) convertLegacyTrash(ca *ModelCache, i interface{}, ts Timestamp) error {
+	if ca.DeletedAt != nil && ca.DeletedAt.CanSet() {
+		ca.DeletedAt.Set(reflect.ValueOf(ts))
+	}
+
+	if _, err := c.putRecord(ca, i); err != nil {
+		return err
+	}
+
+	put := &s3.PutObjectInput{
+		Bucket: &c.Bucket,
+		Key:    aws.String(encodeTrashMarker(ca.Collection, ca.GetModelID())),
+	}
+
+	if _, err := c.Service.PutObject(c.context(), put, c.apiOptions()...); err != nil {
+		return err
+	}
+
+	return nil
 }
@@ -0,0 +1,576 @@
+package pomdb
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Metadata keys of encrypted records.
+const (
+	metaEncryption = "pomdb-encryption"
+	metaKeyID      = "pomdb-key-id"
+	metaDataKey    = "pomdb-data-key"
+	metaFields     = "pomdb-encrypted-fields"
+)
+
+const (
+	// encryptionAlgorithm identifies the cipher of encrypted records. The
+	// ciphertext is bound to the collection and ID of its record, so it
+	// cannot be moved to another record.
+	encryptionAlgorithm = "AES-256-GCM-v2"
+
+	// encryptionAlgorithmUnbound identifies records encrypted before
+	// ciphertexts were bound to their records.
+	encryptionAlgorithmUnbound = "AES-256-GCM"
+)
+
+// KeyProvider wraps and unwraps the data keys that encrypt records, with
+// master keys it holds. It is implemented by a Keyring for local use, or
+// by a key management service in production.
+type KeyProvider interface {
+	// WrapKey encrypts a data key with the current master key, and returns
+	// the encrypted key along with the ID of the master key.
+	WrapKey(ctx context.Context, key []byte) (wrapped []byte, keyID string, err error)
+
+	// UnwrapKey decrypts a data key that was wrapped with the given master
+	// key.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Encryptor encrypts record bodies with envelope encryption. Each write is
+// encrypted with a new AES-256-GCM data key, which is wrapped by the key
+// provider and stored in the object's metadata.
+//
+// With FieldsOnly set, only the fields tagged `pomdb:"encrypted"` are
+// encrypted, and the rest of the document is stored as plain json. Indexes
+// of encrypted fields are keyed with an HMAC of their value under IndexKey,
+// a blind index, so their values do not appear in object keys.
+type Encryptor struct {
+	Keys       KeyProvider
+	FieldsOnly bool
+	IndexKey   []byte
+}
+
+// encrypt encrypts a record body, bound to the given additional data, and
+// returns the ciphertext along with the metadata needed to decrypt it.
+func (e *Encryptor) encrypt(ctx context.Context, plaintext, ad []byte) ([]byte, map[string]string, error) {
+	// Generate a data key for the record
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, nil, err
+	}
+
+	wrapped, keyID, err := e.Keys.WrapKey(ctx, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[Error] Encrypt: %w", err)
+	}
+
+	ciphertext, err := seal(key, plaintext, ad)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meta := map[string]string{
+		metaEncryption: encryptionAlgorithm,
+		metaKeyID:      keyID,
+		metaDataKey:    base64.StdEncoding.EncodeToString(wrapped),
+	}
+
+	return ciphertext, meta, nil
+}
+
+// encryptRecordFields encrypts the encrypted fields of an encoded record,
+// if the client only encrypts fields, and returns the metadata needed to
+// decrypt them.
+func (c *Client) encryptRecordFields(ca *ModelCache, codec Codec, enc []byte) ([]byte, map[string]string, error) {
+	if c.Encryptor == nil {
+		if len(ca.Encrypted) > 0 {
+			return nil, nil, fmt.Errorf("[Error] Encrypt: %w: model has encrypted fields but client has no encryptor", ErrInvalidModel)
+		}
+		return enc, nil, nil
+	}
+
+	if !c.Encryptor.FieldsOnly || len(ca.Encrypted) == 0 {
+		return enc, nil, nil
+	}
+
+	return c.Encryptor.encryptFields(c.context(), codec, enc, ca.Encrypted, recordAD(ca.Collection, ca.GetModelID()))
+}
+
+// encryptRecordBody encrypts a record body, unless the client only
+// encrypts fields, and adds the metadata needed to decrypt it to meta.
+func (c *Client) encryptRecordBody(ca *ModelCache, body []byte, meta map[string]string) ([]byte, map[string]string, error) {
+	if c.Encryptor == nil || c.Encryptor.FieldsOnly {
+		return body, meta, nil
+	}
+
+	enc, emeta, err := c.Encryptor.encrypt(c.context(), body, recordAD(ca.Collection, ca.GetModelID()))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for k, v := range meta {
+		emeta[k] = v
+	}
+
+	return enc, emeta, nil
+}
+
+// decryptRecordBody decrypts a record body, if it was encrypted whole, with
+// the additional data of the record it was read for.
+func (c *Client) decryptRecordBody(body, ad []byte, meta map[string]string) ([]byte, error) {
+	if !isEncrypted(meta) || meta[metaFields] != "" {
+		return body, nil
+	}
+
+	if c.Encryptor == nil {
+		return nil, fmt.Errorf("[Error] Decrypt: %w: record is encrypted", ErrNoEncryptor)
+	}
+
+	return c.Encryptor.decrypt(c.context(), body, ad, meta)
+}
+
+// decryptRecordFields decrypts the encrypted fields of a record body, if
+// any, with the additional data of the record it was read for.
+func (c *Client) decryptRecordFields(codec Codec, body, ad []byte, meta map[string]string) ([]byte, error) {
+	if meta[metaFields] == "" {
+		return body, nil
+	}
+
+	if c.Encryptor == nil {
+		return nil, fmt.Errorf("[Error] Decrypt: %w: record is encrypted", ErrNoEncryptor)
+	}
+
+	return c.Encryptor.decryptFields(c.context(), codec, body, ad, meta)
+}
+
+// encryptFields encrypts the given string fields of an encoded record, bound
+// to the given additional data, and returns the record along with the
+// metadata needed to decrypt it.
+func (e *Encryptor) encryptFields(ctx context.Context, codec Codec, enc []byte, fields []string, ad []byte) ([]byte, map[string]string, error) {
+	doc := map[string]interface{}{}
+	if err := decodeDocument(codec, enc, &doc); err != nil {
+		return nil, nil, err
+	}
+
+	// Encrypt the fields with a single data key
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, nil, err
+	}
+
+	var sealed []string
+	for _, f := range fields {
+		if doc[f] == nil {
+			continue
+		}
+
+		s, ok := doc[f].(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("[Error] Encrypt: %w: field %s is not a string", ErrInvalidModel, f)
+		}
+
+		ciphertext, err := seal(key, []byte(s), fieldAD(ad, f))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		doc[f] = base64.StdEncoding.EncodeToString(ciphertext)
+		sealed = append(sealed, f)
+	}
+
+	if len(sealed) == 0 {
+		return enc, nil, nil
+	}
+
+	wrapped, keyID, err := e.Keys.WrapKey(ctx, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[Error] Encrypt: %w", err)
+	}
+
+	out, err := codec.Marshal(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meta := map[string]string{
+		metaEncryption: encryptionAlgorithm,
+		metaKeyID:      keyID,
+		metaDataKey:    base64.StdEncoding.EncodeToString(wrapped),
+		metaFields:     strings.Join(sealed, ","),
+	}
+
+	return out, meta, nil
+}
+
+// decryptFields decrypts the fields of a record body listed in its
+// metadata.
+func (e *Encryptor) decryptFields(ctx context.Context, codec Codec, body, ad []byte, meta map[string]string) ([]byte, error) {
+	key, err := e.dataKey(ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := map[string]interface{}{}
+	if err := decodeDocument(codec, body, &doc); err != nil {
+		return nil, err
+	}
+
+	for _, f := range strings.Split(meta[metaFields], ",") {
+		s, ok := doc[f].(string)
+		if !ok {
+			continue
+		}
+
+		ciphertext, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("[Error] Decrypt: field %s: %w", f, err)
+		}
+
+		// Fields encrypted before ciphertexts were bound have no additional
+		// data
+		var fad []byte
+		if meta[metaEncryption] == encryptionAlgorithm {
+			fad = fieldAD(ad, f)
+		}
+
+		plaintext, err := open(key, ciphertext, fad)
+		if err != nil {
+			return nil, err
+		}
+
+		doc[f] = string(plaintext)
+	}
+
+	return codec.Marshal(doc)
+}
+
+// blindIndex returns the keyed hash that stands in for the value of an
+// encrypted index field.
+func (e *Encryptor) blindIndex(collection, field string, value any) (string, error) {
+	if len(e.IndexKey) == 0 {
+		return "", fmt.Errorf("[Error] blindIndex: encryptor has no index key for encrypted index %s", field)
+	}
+
+	mac := hmac.New(sha256.New, e.IndexKey)
+	mac.Write([]byte(collection + "/" + field + "/" + fmt.Sprintf("%v", value)))
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// indexPrefix returns the index path for the given index field and value.
+// Values of encrypted index fields are replaced by their blind index.
+func (c *Client) indexPrefix(collection string, idx IndexField, value any) (string, error) {
+	if idx.Encrypted && value != "" {
+		if c.Encryptor == nil {
+			return "", fmt.Errorf("[Error] indexPrefix: %w: model has encrypted fields but client has no encryptor", ErrInvalidModel)
+		}
+
+		if idx.IndexType == RangedIndex {
+			return "", fmt.Errorf("[Error] indexPrefix: %w: encrypted index %s cannot be ranged", ErrInvalidModel, idx.FieldName)
+		}
+
+		blind, err := c.Encryptor.blindIndex(collection, idx.FieldName, value)
+		if err != nil {
+			return "", err
+		}
+
+		value = blind
+	}
+
+	return encodeIndexPrefix(collection, idx.FieldName, value, idx.IndexType)
+}
+
+// decrypt decrypts a record body with the data key in its metadata.
+func (e *Encryptor) decrypt(ctx context.Context, ciphertext, ad []byte, meta map[string]string) ([]byte, error) {
+	key, err := e.dataKey(ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	// Records encrypted before ciphertexts were bound have no additional
+	// data
+	if meta[metaEncryption] != encryptionAlgorithm {
+		ad = nil
+	}
+
+	return open(key, ciphertext, ad)
+}
+
+// dataKey unwraps the data key in an encrypted record's metadata.
+func (e *Encryptor) dataKey(ctx context.Context, meta map[string]string) ([]byte, error) {
+	if alg := meta[metaEncryption]; alg != encryptionAlgorithm && alg != encryptionAlgorithmUnbound {
+		return nil, fmt.Errorf("[Error] Decrypt: unsupported encryption %s", alg)
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(meta[metaDataKey])
+	if err != nil {
+		return nil, fmt.Errorf("[Error] Decrypt: invalid data key: %w", err)
+	}
+
+	key, err := e.Keys.UnwrapKey(ctx, meta[metaKeyID], wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("[Error] Decrypt: %w", err)
+	}
+
+	return key, nil
+}
+
+// isEncrypted reports whether an object's metadata marks it as encrypted.
+func isEncrypted(meta map[string]string) bool {
+	return meta[metaEncryption] != ""
+}
+
+// recordAD returns the additional data that binds a record's ciphertext to
+// its collection and ID.
+func recordAD(collection, id string) []byte {
+	return []byte(collection + "/" + id)
+}
+
+// fieldAD returns the additional data that binds an encrypted field to its
+// record and name, so it cannot be moved to another field.
+func fieldAD(ad []byte, field string) []byte {
+	return append(append(append([]byte(nil), ad...), '#'), field...)
+}
+
+// seal encrypts plaintext with AES-GCM, bound to the given additional data,
+// prefixing the ciphertext with its random nonce.
+func seal(key, plaintext, ad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+// open decrypts ciphertext sealed by seal with the same additional data.
+func open(key, ciphertext, ad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("[Error] Decrypt: ciphertext is too short")
+	}
+
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, sealed, ad)
+	if err != nil {
+		return nil, fmt.Errorf("[Error] Decrypt: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// Keyring is a KeyProvider that holds its master keys in memory. New data
+// keys are wrapped with the primary key, and keys that were rotated out are
+// kept to unwrap existing records. Keyring is meant for tests and local
+// development; production deployments should keep master keys in a key
+// management service.
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[string][]byte
+	primary string
+}
+
+// NewKeyring returns a keyring with the given 32-byte master key as its
+// primary key.
+func NewKeyring(id string, key []byte) (*Keyring, error) {
+	k := &Keyring{keys: map[string][]byte{}}
+	if err := k.Rotate(id, key); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Rotate adds a 32-byte master key to the keyring and makes it the primary
+// key. Use Client.Rekey to rewrap existing data keys with it.
+func (k *Keyring) Rotate(id string, key []byte) error {
+	if len(key) != 32 {
+		return errors.New("[Error] Keyring: master key must be 32 bytes")
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys[id] = key
+	k.primary = id
+
+	return nil
+}
+
+// WrapKey wraps a data key with the primary master key.
+func (k *Keyring) WrapKey(ctx context.Context, key []byte) ([]byte, string, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	wrapped, err := seal(k.keys[k.primary], key, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return wrapped, k.primary, nil
+}
+
+// UnwrapKey unwraps a data key with the given master key.
+func (k *Keyring) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	master, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("[Error] Keyring: unknown master key %s", keyID)
+	}
+
+	return open(master, wrapped, nil)
+}
+
+// Rekey rewraps the data keys of a collection's encrypted records, versions
+// and changelog entries with the key provider's current master key, and
+// returns the number of objects rewrapped. Record bodies are not
+// re-encrypted; objects are copied in place with new metadata.
+func (c *Client) Rekey(ctx context.Context, model interface{}) (int, error) {
+	c = c.WithContext(ctx)
+
+	if c.Encryptor == nil {
+		return 0, fmt.Errorf("[Error] Rekey: %w", ErrNoEncryptor)
+	}
+
+	// Dereference the input
+	rv, err := dereferenceStruct(model)
+	if err != nil {
+		return 0, err
+	}
+
+	// Build the struct cache
+	ca := NewModelCache(rv)
+
+	// Get the collection's records, versions and changelog entries
+	recs, err := c.listObjectsAfter(ca.Collection+"/", "", true)
+	if err != nil {
+		return 0, err
+	}
+
+	vers, err := c.listObjects(ca.Collection + "/versions/")
+	if err != nil {
+		return 0, err
+	}
+
+	chgs, err := c.listObjects(encodeChangePrefix(ca.Collection))
+	if err != nil {
+		return 0, err
+	}
+
+	rekeyed := 0
+	for _, obj := range append(append(recs, vers...), chgs...) {
+		if err := ctx.Err(); err != nil {
+			return rekeyed, err
+		}
+
+		ok, err := c.rekeyObject(*obj.Key)
+		if err != nil {
+			return rekeyed, err
+		}
+
+		if ok {
+			rekeyed++
+		}
+	}
+
+	return rekeyed, nil
+}
+
+// rekeyObject rewraps the data key of an encrypted object, and reports
+// whether the object was rewritten.
+func (c *Client) rekeyObject(key string) (bool, error) {
+	head := &s3.HeadObjectInput{
+		Bucket: &c.Bucket,
+		Key:    &key,
+	}
+
+	res, err := c.Service.HeadObject(c.context(), head, c.apiOptions()...)
+	if err != nil {
+		return false, err
+	}
+
+	if !isEncrypted(res.Metadata) {
+		return false, nil
+	}
+
+	// Rewrap the data key
+	dk, err := c.Encryptor.dataKey(c.context(), res.Metadata)
+	if err != nil {
+		return false, err
+	}
+
+	wrapped, keyID, err := c.Encryptor.Keys.WrapKey(c.context(), dk)
+	if err != nil {
+		return false, err
+	}
+
+	if keyID == res.Metadata[metaKeyID] {
+		return false, nil
+	}
+
+	meta := make(map[string]string, len(res.Metadata))
+	for k, v := range res.Metadata {
+		meta[k] = v
+	}
+	meta[metaKeyID] = keyID
+	meta[metaDataKey] = base64.StdEncoding.EncodeToString(wrapped)
+
+	// Copy the object onto itself, unless it changed since it was read
+	cpy := &s3.CopyObjectInput{
+		Bucket:            &c.Bucket,
+		Key:               &key,
+		CopySource:        aws.String(c.Bucket + "/" + key),
+		CopySourceIfMatch: res.ETag,
+		ContentType:       res.ContentType,
+		ContentEncoding:   res.ContentEncoding,
+		Metadata:          meta,
+		MetadataDirective: types.MetadataDirectiveReplace,
+	}
+
+	if _, err := c.Service.CopyObject(c.context(), cpy, c.apiOptions()...); err != nil {
+		if isPreconditionFailed(err) {
+			return false, fmt.Errorf("[Error] Rekey: %w: key=%s: %w", ErrConflict, key, err)
+		}
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,68 @@
+package pomdb
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned when a record or version does not exist, or is
+	// excluded from a query because it is soft-deleted or expired.
+	ErrNotFound = errors.New("record not found")
+
+	// ErrConflict is returned when a conditional write fails because the
+	// record was modified concurrently.
+	ErrConflict = errors.New("record was modified concurrently")
+
+	// ErrRecordExists is returned when a record is imported with the ID of
+	// a stored record.
+	ErrRecordExists = errors.New("record already exists")
+
+	// ErrInvalidModel is returned when a model is not a pointer to a valid
+	// struct, or fails validation.
+	ErrInvalidModel = errors.New("invalid model")
+
+	// ErrIndexNotFound is returned when a query or upsert names a field that
+	// is not indexed.
+	ErrIndexNotFound = errors.New("index field not found")
+
+	// ErrInvalidQuery is returned when a query or upsert names a field that
+	// is indexed in a way that does not support it.
+	ErrInvalidQuery = errors.New("invalid query")
+
+	// ErrMultipleRecords is returned when a lookup expected to match one
+	// record matches several.
+	ErrMultipleRecords = errors.New("multiple records found")
+
+	// ErrNoHistory is returned when the history of a record is requested from
+	// a collection that does not keep history.
+	ErrNoHistory = errors.New("collection does not keep history")
+
+	// ErrNoEncryptor is returned when an encrypted record is read, or keys
+	// are rotated, by a client without an encryptor.
+	ErrNoEncryptor = errors.New("client has no encryptor")
+)
+
+// ErrUniqueViolation is returned when a record would share the value of a
+// unique index with another record. The value is left out of the error
+// message, since it may contain personal data.
+type ErrUniqueViolation struct {
+	Field string
+	Value string
+}
+
+func (e *ErrUniqueViolation) Error() string {
+	return fmt.Sprintf("unique index %s already has this value", e.Field)
+}
+
+// Is reports whether target is a unique violation. Empty fields of target
+// match any value, so errors.Is(err, &ErrUniqueViolation{}) matches any
+// unique violation.
+func (e *ErrUniqueViolation) Is(target error) bool {
+	t, ok := target.(*ErrUniqueViolation)
+	if !ok {
+		return false
+	}
+
+	return (t.Field == "" || t.Field == e.Field) && (t.Value == "" || t.Value == e.Value)
+}
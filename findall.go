@@ -1,13 +1,8 @@
 package pomdb
 
 import (
-	"context"
-	"encoding/json"
-	"reflect"
 	"strings"
-	"sync"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
@@ -19,6 +14,13 @@ type FindAllResult struct {
 
 // FindAll returns all objects of a given collection.
 func (c *Client) FindAll(q Query) (*FindAllResult, error) {
+	return invokeAs[*FindAllResult](c, &Operation{Name: "FindAll", Model: q.Model, Query: &q}, func(c *Client, op *Operation) (interface{}, error) {
+		return c.findAll(*op.Query)
+	})
+}
+
+// findAll implements FindAll.
+func (c *Client) findAll(q Query) (*FindAllResult, error) {
 	// Set default limit
 	if q.Limit == 0 {
 		q.Limit = QueryLimitDefault
@@ -36,79 +38,22 @@ func (c *Client) FindAll(q Query) (*FindAllResult, error) {
 	// Set record prefix path
 	pfx := ca.Collection + "/"
 
-	// List all objects concurrently
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var allObjects []types.Object
-	var startAfter *string
-
-	// If the query includes a next token, use it as the starting point
-	if q.NextToken != "" {
-		startAfter = &q.NextToken
+	// List all objects after the next token, if any
+	allObjects, err := c.listObjectsAfter(pfx, q.NextToken, true)
+	if err != nil {
+		return nil, err
 	}
 
-	for {
-		lst := &s3.ListObjectsV2Input{
-			Bucket:     &c.Bucket,
-			Prefix:     &pfx,
-			StartAfter: startAfter,
-			Delimiter:  aws.String("/"), // Ensures directories are handled correctly
+	// Filter soft deletes
+	if q.Trashed != QueryWithTrashed {
+		trashed, err := c.listTrashed(ca.Collection)
+		if err != nil {
+			return nil, err
 		}
 
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			pge, err := c.Service.ListObjectsV2(context.TODO(), lst)
-			if err != nil {
-				return
-			}
-
-			mu.Lock()
-			for _, obj := range pge.Contents {
-				// Filter out directories
-				if !strings.HasSuffix(*obj.Key, "/") {
-					allObjects = append(allObjects, obj)
-				}
-			}
-			// Set startAfter to the last object key in this batch
-			if len(pge.Contents) > 0 {
-				startAfter = pge.Contents[len(pge.Contents)-1].Key
-			} else {
-				startAfter = nil
-			}
-			mu.Unlock()
-		}()
-
-		if startAfter == nil {
-			break
-		}
-	}
-
-	wg.Wait()
-
-	// Filter soft deletes
-	if c.SoftDeletes {
 		var active []types.Object
 		for _, o := range allObjects {
-			tag := &s3.GetObjectTaggingInput{
-				Bucket: &c.Bucket,
-				Key:    o.Key,
-			}
-
-			tags, err := c.Service.GetObjectTagging(context.TODO(), tag)
-			if err != nil {
-				return nil, err
-			}
-
-			deleted := false
-			for _, t := range tags.TagSet {
-				if *t.Key == "DeletedAt" {
-					deleted = true
-					break
-				}
-			}
-
-			if !deleted {
+			if q.includes(trashed[strings.TrimPrefix(*o.Key, pfx)]) {
 				active = append(active, o)
 			}
 		}
@@ -125,7 +70,7 @@ func (c *Client) FindAll(q Query) (*FindAllResult, error) {
 	var nextToken string
 	for i, obj := range allObjects {
 		if i >= q.Limit {
-			nextToken = *obj.Key
+			nextToken = *allObjects[i-1].Key
 			break
 		}
 
@@ -134,18 +79,25 @@ func (c *Client) FindAll(q Query) (*FindAllResult, error) {
 			Key:    obj.Key,
 		}
 
-		rec, err := c.Service.GetObject(context.TODO(), get)
+		rec, err := c.Service.GetObject(c.context(), get, c.apiOptions()...)
 		if err != nil {
 			continue
 		}
 
-		elem := reflect.TypeOf(ca.Reference).Elem()
-		model := reflect.New(elem).Interface()
-		err = json.NewDecoder(rec.Body).Decode(&model)
+		model, err := c.decodeRecord(ca, *obj.Key, rec)
 		if err != nil {
 			continue
 		}
 
+		// Filter expired records
+		if c.isExpired(ca.Collection, model) {
+			continue
+		}
+
+		if err := runHook(c.context(), model, afterFind); err != nil {
+			return nil, err
+		}
+
 		docs = append(docs, model)
 	}
 
@@ -1,12 +1,8 @@
 package pomdb
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
-	"reflect"
 	"strings"
-	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -20,8 +16,15 @@ type FindManyResult struct {
 
 // FindMany retrieves multiple objects of a given index.
 func (c *Client) FindMany(q Query) (*FindManyResult, error) {
+	return invokeAs[*FindManyResult](c, &Operation{Name: "FindMany", Model: q.Model, Query: &q}, func(c *Client, op *Operation) (interface{}, error) {
+		return c.findMany(*op.Query)
+	})
+}
+
+// findMany implements FindMany.
+func (c *Client) findMany(q Query) (*FindManyResult, error) {
 	if q.Field == "id" {
-		return nil, fmt.Errorf("FindMany: cannot search by id")
+		return nil, fmt.Errorf("[Error] FindMany: %w: cannot search by id", ErrInvalidQuery)
 	}
 
 	// Set default limit
@@ -47,92 +50,54 @@ func (c *Client) FindMany(q Query) (*FindManyResult, error) {
 		}
 	}
 	if idx == nil {
-		return nil, fmt.Errorf("FindMany: index field %s not found", q.Field)
+		return nil, fmt.Errorf("[Error] FindMany: %w: %s", ErrIndexNotFound, q.Field)
 	}
 
-	// Set index prefix path
-	pfx, err := encodeQueryPrefix(ca.Collection, q.Field, idx.IndexType)
+	// Set index prefix path. Encrypted indexes hold keyed hashes of their
+	// values, so they can only be searched for equal values.
+	var pfx string
+	if idx.Encrypted {
+		if q.Filter != QueryEqual {
+			return nil, fmt.Errorf("[Error] FindMany: %w: encrypted index %s only supports QueryEqual", ErrInvalidQuery, q.Field)
+		}
+
+		pfx, err = c.indexPrefix(ca.Collection, *idx, q.Value)
+	} else {
+		pfx, err = encodeQueryPrefix(ca.Collection, q.Field, idx.IndexType)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	// List all objects concurrently
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var allObjects []types.Object
-	var startAfter *string
-
-	// If the query includes a next token, use it as the starting point
-	if q.NextToken != "" {
-		startAfter = &q.NextToken
+	// Soft-deleted records are indexed under the trash path
+	var prefixes []string
+	if q.Trashed != QueryOnlyTrashed {
+		prefixes = append(prefixes, pfx+"/")
 	}
-
-	for {
-		lst := &s3.ListObjectsV2Input{
-			Bucket:     &c.Bucket,
-			Prefix:     &pfx,
-			StartAfter: startAfter,
-		}
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			pge, err := c.Service.ListObjectsV2(context.TODO(), lst)
-			if err != nil {
-				return
-			}
-
-			mu.Lock()
-			allObjects = append(allObjects, pge.Contents...)
-			// Set startAfter to the last object key in this batch
-			if len(pge.Contents) > 0 {
-				startAfter = pge.Contents[len(pge.Contents)-1].Key
-			} else {
-				startAfter = nil
-			}
-			mu.Unlock()
-		}()
-
-		if startAfter == nil {
-			break
-		}
+	if q.Trashed != QueryExcludeTrashed {
+		prefixes = append(prefixes, encodeTrashKey(pfx+"/"))
 	}
 
-	wg.Wait()
-
-	// Filter soft-deletes
-	if c.SoftDeletes {
-		var visible []types.Object
-		for _, o := range allObjects {
-			tag := &s3.GetObjectTaggingInput{
-				Bucket: &c.Bucket,
-				Key:    o.Key,
-			}
-
-			tags, err := c.Service.GetObjectTagging(context.TODO(), tag)
-			if err != nil {
-				continue
-			}
-
-			deleted := false
-			for _, t := range tags.TagSet {
-				if *t.Key == "DeletedAt" {
-					deleted = true
-					break
-				}
-			}
-
-			if !deleted {
-				visible = append(visible, o)
-			}
+	// List all objects after the next token, if any. Trash keys sort after
+	// index keys, so the token applies to both paths.
+	var allObjects []types.Object
+	for _, p := range prefixes {
+		objs, err := c.listObjectsAfter(p, q.NextToken, false)
+		if err != nil {
+			return nil, err
 		}
 
-		allObjects = visible
+		allObjects = append(allObjects, objs...)
 	}
 
 	// Apply query filters
 	var filtered []types.Object
 	for _, obj := range allObjects {
+		if idx.Encrypted {
+			filtered = append(filtered, obj)
+			continue
+		}
+
 		res, err := q.Compare(obj, idx)
 		if err != nil {
 			return nil, err
@@ -148,7 +113,7 @@ func (c *Client) FindMany(q Query) (*FindManyResult, error) {
 	var nextToken string
 	for i, o := range allObjects {
 		if i >= q.Limit {
-			nextToken = *o.Key
+			nextToken = *allObjects[i-1].Key
 			break
 		}
 
@@ -159,18 +124,25 @@ func (c *Client) FindMany(q Query) (*FindManyResult, error) {
 			Key:    aws.String(ca.Collection + "/" + uid),
 		}
 
-		doc, err := c.Service.GetObject(context.TODO(), get)
+		doc, err := c.Service.GetObject(c.context(), get, c.apiOptions()...)
 		if err != nil {
 			continue
 		}
 
-		elem := reflect.TypeOf(ca.Reference).Elem()
-		model := reflect.New(elem).Interface()
-		err = json.NewDecoder(doc.Body).Decode(&model)
+		model, err := c.decodeRecord(ca, *get.Key, doc)
 		if err != nil {
 			continue
 		}
 
+		// Filter expired records
+		if c.isExpired(ca.Collection, model) {
+			continue
+		}
+
+		if err := runHook(c.context(), model, afterFind); err != nil {
+			return nil, err
+		}
+
 		docs = append(docs, model)
 	}
 
@@ -1,8 +1,6 @@
 package pomdb
 
 import (
-	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
@@ -14,6 +12,13 @@ import (
 
 // FindOne retrieves a single object of a given collection or index.
 func (c *Client) FindOne(q Query) (interface{}, error) {
+	return c.invoke(&Operation{Name: "FindOne", Model: q.Model, Query: &q}, func(c *Client, op *Operation) (interface{}, error) {
+		return c.findOne(*op.Query)
+	})
+}
+
+// findOne implements FindOne.
+func (c *Client) findOne(q Query) (interface{}, error) {
 	target := "record"
 	if q.Field != "id" {
 		target = "index"
@@ -41,58 +46,61 @@ func (c *Client) FindOne(q Query) (interface{}, error) {
 			}
 		}
 		if idx == nil {
-			return nil, fmt.Errorf("FindOne: index field %s not found", q.Field)
+			return nil, fmt.Errorf("[Error] FindOne: %w: %s", ErrIndexNotFound, q.Field)
 		}
 
 		// Set index pfx path
-		pfx, err := encodeIndexPrefix(ca.Collection, q.Field, q.Value, idx.IndexType)
+		pfx, err := c.indexPrefix(ca.Collection, *idx, q.Value)
 		if err != nil {
 			return nil, err
 		}
 
-		// Check if index exists
-		lst := &s3.ListObjectsV2Input{
-			Bucket: &c.Bucket,
-			Prefix: &pfx,
+		// Soft-deleted records are indexed under the trash path
+		var objs []types.Object
+		if q.Trashed != QueryOnlyTrashed {
+			if objs, err = c.listObjects(pfx + "/"); err != nil {
+				return nil, err
+			}
 		}
 
-		res, err := c.Service.ListObjectsV2(context.TODO(), lst)
-		if err != nil {
-			return nil, err
+		// Prefer a live record to trashed records with the same value
+		if len(objs) == 0 && q.Trashed != QueryExcludeTrashed {
+			if objs, err = c.listObjects(encodeTrashKey(pfx + "/")); err != nil {
+				return nil, err
+			}
 		}
 
-		if res.Contents == nil {
-			return nil, fmt.Errorf("FindOne: index not found: collection=%s, field=%s, value=%s", ca.Collection, q.Field, q.Value)
+		if len(objs) == 0 {
+			return nil, fmt.Errorf("[Error] FindOne: %w: collection=%s, field=%s", ErrNotFound, ca.Collection, q.Field)
 		}
 
-		if len(res.Contents) > 1 {
-			return nil, fmt.Errorf("FindOne: multiple records found: collection=%s, field=%s, value=%s", ca.Collection, q.Field, q.Value)
+		if len(objs) > 1 {
+			return nil, fmt.Errorf("[Error] FindOne: %w: collection=%s, field=%s", ErrMultipleRecords, ca.Collection, q.Field)
 		}
 
 		// Get record id
-		uid := strings.TrimPrefix(*res.Contents[0].Key, pfx+"/")
+		uid := (*objs[0].Key)[strings.LastIndex(*objs[0].Key, "/")+1:]
 
 		// Set key path
 		key = ca.Collection + "/" + uid
 	}
 
-	// Filter soft deletes
-	if c.SoftDeletes {
-		tag := &s3.GetObjectTaggingInput{
-			Bucket: &c.Bucket,
-			Key:    &key,
-		}
-
-		tags, err := c.Service.GetObjectTagging(context.TODO(), tag)
+	// Fetch the version current at the requested time
+	if !q.AsOf.IsNil() {
+		ver, err := c.findVersion(ca, strings.TrimPrefix(key, ca.Collection+"/"), q.AsOf)
 		if err != nil {
 			return nil, err
 		}
 
-		for _, t := range tags.TagSet {
-			if *t.Key == "DeletedAt" {
-				return nil, fmt.Errorf("FindOne: record not found: collection=%s, field=%s, value=%s", ca.Collection, q.Field, q.Value)
-			}
+		if ver == nil {
+			return nil, fmt.Errorf("[Error] FindOne: %w: collection=%s, field=%s", ErrNotFound, ca.Collection, q.Field)
 		}
+
+		if err := runHook(c.context(), ver.Doc, afterFind); err != nil {
+			return nil, err
+		}
+
+		return ver.Doc, nil
 	}
 
 	get := &s3.GetObjectInput{
@@ -102,19 +110,38 @@ func (c *Client) FindOne(q Query) (interface{}, error) {
 
 	// Fetch the record
 	var noSuchKey *types.NoSuchKey
-	rec, err := c.Service.GetObject(context.TODO(), get)
+	rec, err := c.Service.GetObject(c.context(), get, c.apiOptions()...)
 	if err != nil && errors.As(err, &noSuchKey) {
-		return nil, fmt.Errorf("FindOne: record not found: collection=%s, field=%s, value=%s", ca.Collection, q.Field, q.Value)
+		return nil, fmt.Errorf("[Error] FindOne: %w: collection=%s, field=%s: %w", ErrNotFound, ca.Collection, q.Field, err)
 	} else if err != nil {
 		return nil, err
 	}
 
-	elem := reflect.TypeOf(ca.Reference).Elem()
-	model := reflect.New(elem).Interface()
-	err = json.NewDecoder(rec.Body).Decode(&model)
+	model, err := c.decodeRecord(ca, key, rec)
 	if err != nil {
 		return nil, err
 	}
 
+	// Filter soft deletes
+	if q.Trashed != QueryWithTrashed {
+		trashed, err := c.isTrashed(NewModelCache(reflect.ValueOf(model).Elem()))
+		if err != nil {
+			return nil, err
+		}
+
+		if !q.includes(trashed) {
+			return nil, fmt.Errorf("[Error] FindOne: %w: collection=%s, field=%s", ErrNotFound, ca.Collection, q.Field)
+		}
+	}
+
+	// Filter expired records
+	if c.isExpired(ca.Collection, model) {
+		return nil, fmt.Errorf("[Error] FindOne: %w: collection=%s, field=%s", ErrNotFound, ca.Collection, q.Field)
+	}
+
+	if err := runHook(c.context(), model, afterFind); err != nil {
+		return nil, err
+	}
+
 	return model, nil
 }
@@ -0,0 +1,188 @@
+package pomdb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Version is a stored version of a record in a collection with history.
+type Version struct {
+	ID        string
+	Timestamp Timestamp
+	Doc       interface{}
+
+	// ETag is the entity tag of the version, which is the record's entity
+	// tag when it was written, as versions are stored with the same body.
+	ETag string
+}
+
+// History returns every stored version of a record, oldest first. The model
+// must hold the ID of the record.
+func (c *Client) History(i interface{}) ([]Version, error) {
+	return invokeAs[[]Version](c, &Operation{Name: "History", Model: i}, func(c *Client, op *Operation) (interface{}, error) {
+		return c.history(op.Model)
+	})
+}
+
+// history implements History.
+func (c *Client) history(i interface{}) ([]Version, error) {
+	// Dereference the input
+	rv, err := dereferenceStruct(i)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the struct cache
+	ca := NewModelCache(rv)
+
+	objs, err := c.listVersions(ca, ca.GetModelID())
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []Version
+	for _, obj := range objs {
+		ver, err := c.getVersion(ca, *obj.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, *ver)
+	}
+
+	return versions, nil
+}
+
+// Revert replaces a record with one of its stored versions. The model must
+// hold the ID of the record, and holds the reverted record on success.
+func (c *Client) Revert(i interface{}, version string) (*string, error) {
+	return c.invokeETag(&Operation{Name: "Revert", Model: i, Version: version}, func(c *Client, op *Operation) (interface{}, error) {
+		return c.revert(op.Model, op.Version)
+	})
+}
+
+// revert implements Revert.
+func (c *Client) revert(i interface{}, version string) (*string, error) {
+	// Dereference the input
+	rv, err := dereferenceStruct(i)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the struct cache
+	ca := NewModelCache(rv)
+
+	// Get the requested version
+	key := ca.Collection + "/versions/" + ca.GetModelID() + "/" + version
+	ver, err := c.getVersion(ca, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the current record
+	prev, _, err := c.getRecord(ca, ca.Collection+"/"+ca.GetModelID())
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the version into the model
+	rv.Set(reflect.ValueOf(ver.Doc).Elem())
+
+	// Rebuild the struct cache from the reverted model
+	ca = NewModelCache(rv)
+	ca.SetUpdatedAt()
+
+	return c.updateRecord(ca, i, prev)
+}
+
+// findVersion returns the version of a record that was current at the given
+// time, or nil if the record did not exist yet.
+func (c *Client) findVersion(ca *ModelCache, id string, at Timestamp) (*Version, error) {
+	objs, err := c.listVersions(ca, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Timestamps have a resolution of one second
+	end := time.Time(at).Truncate(time.Second).Add(time.Second)
+
+	var key *string
+	for _, obj := range objs {
+		ts, err := decodeVersionKey(*obj.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		if !time.Time(ts).Before(end) {
+			break
+		}
+
+		key = obj.Key
+	}
+
+	if key == nil {
+		return nil, nil
+	}
+
+	return c.getVersion(ca, *key)
+}
+
+// listVersions returns the stored versions of a record, oldest first.
+func (c *Client) listVersions(ca *ModelCache, id string) ([]types.Object, error) {
+	if !c.options(ca.Collection).History {
+		return nil, fmt.Errorf("[Error] History: %w: collection=%s", ErrNoHistory, ca.Collection)
+	}
+
+	return c.listObjects(ca.Collection + "/versions/" + id + "/")
+}
+
+// getVersion fetches and decodes the record version stored at key.
+func (c *Client) getVersion(ca *ModelCache, key string) (*Version, error) {
+	ts, err := decodeVersionKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, etag, err := c.getRecord(ca, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Version{
+		ID:        key[strings.LastIndex(key, "/")+1:],
+		Timestamp: ts,
+		Doc:       doc,
+		ETag:      aws.ToString(etag),
+	}, nil
+}
+
+// DeleteVersions deletes the stored versions of a record.
+func (c *Client) DeleteVersions(ca *ModelCache) error {
+	if !c.options(ca.Collection).History {
+		return nil
+	}
+
+	objs, err := c.listVersions(ca, ca.GetModelID())
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		del := &s3.DeleteObjectInput{
+			Bucket: &c.Bucket,
+			Key:    obj.Key,
+		}
+
+		if _, err := c.Service.DeleteObject(c.context(), del, c.apiOptions()...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package pomdb
+
+import (
+	"context"
+)
+
+// BeforeCreateHook is implemented by models that run logic before they are
+// created. Returning an error aborts the create.
+type BeforeCreateHook interface {
+	BeforeCreate(ctx context.Context) error
+}
+
+// AfterCreateHook is implemented by models that run logic after they are
+// created. A returned error is passed on to the caller.
+type AfterCreateHook interface {
+	AfterCreate(ctx context.Context) error
+}
+
+// BeforeUpdateHook is implemented by models that run logic before they are
+// updated. Returning an error aborts the update.
+type BeforeUpdateHook interface {
+	BeforeUpdate(ctx context.Context) error
+}
+
+// AfterUpdateHook is implemented by models that run logic after they are
+// updated. A returned error is passed on to the caller.
+type AfterUpdateHook interface {
+	AfterUpdate(ctx context.Context) error
+}
+
+// BeforeDeleteHook is implemented by models that run logic before they are
+// deleted. Returning an error aborts the delete.
+type BeforeDeleteHook interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+// AfterDeleteHook is implemented by models that run logic after they are
+// deleted. A returned error is passed on to the caller.
+type AfterDeleteHook interface {
+	AfterDelete(ctx context.Context) error
+}
+
+// AfterFindHook is implemented by models that run logic after they are
+// found. A returned error is passed on to the caller.
+type AfterFindHook interface {
+	AfterFind(ctx context.Context) error
+}
+
+type hook int
+
+const (
+	beforeCreate hook = iota
+	afterCreate
+	beforeUpdate
+	afterUpdate
+	beforeDelete
+	afterDelete
+	afterFind
+)
+
+// runHook calls the given hook on the model, if the model implements it.
+func runHook(ctx context.Context, i interface{}, h hook) error {
+	switch h {
+	case beforeCreate:
+		if m, ok := i.(BeforeCreateHook); ok {
+			return m.BeforeCreate(ctx)
+		}
+	case afterCreate:
+		if m, ok := i.(AfterCreateHook); ok {
+			return m.AfterCreate(ctx)
+		}
+	case beforeUpdate:
+		if m, ok := i.(BeforeUpdateHook); ok {
+			return m.BeforeUpdate(ctx)
+		}
+	case afterUpdate:
+		if m, ok := i.(AfterUpdateHook); ok {
+			return m.AfterUpdate(ctx)
+		}
+	case beforeDelete:
+		if m, ok := i.(BeforeDeleteHook); ok {
+			return m.BeforeDelete(ctx)
+		}
+	case afterDelete:
+		if m, ok := i.(AfterDeleteHook); ok {
+			return m.AfterDelete(ctx)
+		}
+	case afterFind:
+		if m, ok := i.(AfterFindHook); ok {
+			return m.AfterFind(ctx)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package pomdb
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// IndexKey is the decoded form of an index item's key.
+type IndexKey struct {
+	Collection string
+	IndexType  IndexType
+	Field      string
+
+	// Value is the indexed value. Encrypted indexes hold a keyed hash of
+	// the value instead.
+	Value string
+
+	// ID is the ID of the record the item points to.
+	ID string
+
+	// Trashed reports whether the item is in the collection's trash.
+	Trashed bool
+}
+
+// ParseIndexKey decodes the key of an index item, of the form
+// {collection}/{indexes|trash}/{type}/{field}/{value}/{id}.
+func ParseIndexKey(key string) (*IndexKey, error) {
+	parts := strings.Split(key, "/")
+	if len(parts) < 6 {
+		return nil, fmt.Errorf("[Error] ParseIndexKey: not an index key: %s", key)
+	}
+
+	ik := &IndexKey{
+		Collection: parts[0],
+		Field:      parts[3],
+		ID:         parts[len(parts)-1],
+	}
+
+	switch parts[1] {
+	case "indexes":
+	case "trash":
+		ik.Trashed = true
+	default:
+		return nil, fmt.Errorf("[Error] ParseIndexKey: not an index key: %s", key)
+	}
+
+	switch parts[2] {
+	case "unique":
+		ik.IndexType = UniqueIndex
+	case "shared":
+		ik.IndexType = SharedIndex
+	case "ranged":
+		ik.IndexType = RangedIndex
+	default:
+		return nil, fmt.Errorf("[Error] ParseIndexKey: invalid index type %s", parts[2])
+	}
+
+	// Encoded values may themselves contain slashes
+	value, err := base64.StdEncoding.DecodeString(strings.Join(parts[4:len(parts)-1], "/"))
+	if err != nil {
+		return nil, fmt.Errorf("[Error] ParseIndexKey: invalid index value: %w", err)
+	}
+
+	ik.Value = string(value)
+
+	return ik, nil
+}
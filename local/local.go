@@ -0,0 +1,620 @@
+// Package local serves PomDB buckets from a local directory, for
+// development, tests and offline administration. It implements the subset
+// of the S3 API used by PomDB as an HTTP client for the AWS SDK, so a
+// pomdb.Client works against it unchanged:
+//
+//	client := pomdb.Client{
+//	  Service: local.NewService("./data"),
+//	  Bucket:  "pomdb",
+//	}
+//
+// Each bucket is a subdirectory of the root directory, and each object is
+// a file under its key. Object metadata, such as content types and ETags,
+// is kept under the .metadata subdirectory of the root.
+package local
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ListMaxKeysDefault is the number of keys returned by a list request that
+// does not set MaxKeys, as in S3.
+const ListMaxKeysDefault int = 1000
+
+// MaxSegmentLength is the longest key segment, between slashes, the local
+// backend stores, as most filesystems limit file names to 255 bytes. Long
+// index values may exceed it.
+const MaxSegmentLength int = 255
+
+// Transport is an HTTP client for the AWS SDK that serves S3 requests from
+// a local directory. Requests are served one at a time, so conditional
+// writes are atomic.
+type Transport struct {
+	Root string
+
+	mu sync.Mutex
+}
+
+// metadata is the stored metadata of an object.
+type metadata struct {
+	ETag            string            `json:"etag"`
+	ContentType     string            `json:"content_type,omitempty"`
+	ContentEncoding string            `json:"content_encoding,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	LastModified    time.Time         `json:"last_modified"`
+}
+
+// NewService returns an S3 client whose requests are served from the given
+// root directory.
+func NewService(root string) *s3.Client {
+	return s3.New(s3.Options{
+		Region:       "local",
+		BaseEndpoint: aws.String("http://local"),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+		HTTPClient:   &Transport{Root: root},
+	})
+}
+
+// CreateBucket creates the directory of a bucket, if it does not exist.
+func CreateBucket(root, bucket string) error {
+	return os.MkdirAll(filepath.Join(root, bucket), 0o755)
+}
+
+// Do serves an S3 request.
+func (t *Transport) Do(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+	if bucket == "" || strings.HasPrefix(bucket, ".") {
+		return errorResponse(req, http.StatusBadRequest, "InvalidBucketName", "invalid bucket name")
+	}
+
+	if _, err := os.Stat(filepath.Join(t.Root, bucket)); err != nil {
+		return errorResponse(req, http.StatusNotFound, "NoSuchBucket", "the bucket does not exist")
+	}
+
+	// Keys are paths below the bucket's directory
+	for _, seg := range strings.Split(key, "/") {
+		if key != "" && (seg == "" || seg == "." || seg == "..") {
+			return errorResponse(req, http.StatusBadRequest, "InvalidArgument", "keys with empty, . or .. segments are not supported by the local backend")
+		}
+
+		if len(seg) > MaxSegmentLength {
+			return errorResponse(req, http.StatusBadRequest, "KeyTooLongError", "key segments longer than 255 bytes are not supported by the local backend")
+		}
+	}
+
+	query := req.URL.Query()
+
+	switch {
+	case key == "" && req.Method == http.MethodHead:
+		return response(req, http.StatusOK, nil, nil)
+	case key == "" && req.Method == http.MethodGet && query.Get("list-type") == "2":
+		return t.listObjects(req, bucket, query)
+	case key == "", query.Has("tagging"):
+		return errorResponse(req, http.StatusNotImplemented, "NotImplemented", "the operation is not supported by the local backend")
+	case req.Method == http.MethodGet, req.Method == http.MethodHead:
+		return t.getObject(req, bucket, key)
+	case req.Method == http.MethodPut && req.Header.Get("X-Amz-Copy-Source") != "":
+		return t.copyObject(req, bucket, key)
+	case req.Method == http.MethodPut && len(query) <= 1:
+		return t.putObject(req, bucket, key)
+	case req.Method == http.MethodDelete && len(query) <= 1:
+		return t.deleteObject(req, bucket, key)
+	}
+
+	return errorResponse(req, http.StatusNotImplemented, "NotImplemented", "the operation is not supported by the local backend")
+}
+
+// objectPath returns the path of an object's data.
+func (t *Transport) objectPath(bucket, key string) string {
+	return filepath.Join(t.Root, bucket, filepath.FromSlash(key))
+}
+
+// metadataPath returns the path of an object's metadata.
+func (t *Transport) metadataPath(bucket, key string) string {
+	return filepath.Join(t.Root, ".metadata", bucket, filepath.FromSlash(key)+".json")
+}
+
+// stat returns the metadata of an object, or nil if it does not exist.
+// Objects written to the directory by other means have their metadata
+// computed from their data.
+func (t *Transport) stat(bucket, key string) (*metadata, error) {
+	fi, err := os.Stat(t.objectPath(bucket, key))
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && fi.IsDir()) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(t.metadataPath(bucket, key))
+	if err == nil {
+		meta := &metadata{}
+		if err := json.Unmarshal(b, meta); err == nil {
+			return meta, nil
+		}
+	}
+
+	data, err := os.ReadFile(t.objectPath(bucket, key))
+	if err != nil {
+		return nil, err
+	}
+
+	return &metadata{ETag: etag(data), LastModified: fi.ModTime().UTC()}, nil
+}
+
+// getObject serves GetObject and HeadObject requests.
+func (t *Transport) getObject(req *http.Request, bucket, key string) (*http.Response, error) {
+	meta, err := t.stat(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta == nil {
+		return errorResponse(req, http.StatusNotFound, "NoSuchKey", "the specified key does not exist")
+	}
+
+	if m := req.Header.Get("If-Match"); m != "" && m != meta.ETag && m != "*" {
+		return errorResponse(req, http.StatusPreconditionFailed, "PreconditionFailed", "at least one of the preconditions you specified did not hold")
+	}
+
+	data, err := os.ReadFile(t.objectPath(bucket, key))
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("ETag", meta.ETag)
+	header.Set("Last-Modified", meta.LastModified.UTC().Format(http.TimeFormat))
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+	if meta.ContentType != "" {
+		header.Set("Content-Type", meta.ContentType)
+	}
+	if meta.ContentEncoding != "" {
+		header.Set("Content-Encoding", meta.ContentEncoding)
+	}
+	for k, v := range meta.Metadata {
+		header.Set("X-Amz-Meta-"+k, v)
+	}
+
+	if req.Method == http.MethodHead {
+		data = nil
+	}
+
+	return response(req, http.StatusOK, header, data)
+}
+
+// checkPreconditions checks the If-Match and If-None-Match headers of a
+// write against the object's current metadata.
+func checkPreconditions(req *http.Request, meta *metadata, ifMatch, ifNoneMatch string) bool {
+	if m := req.Header.Get(ifMatch); m != "" && (meta == nil || (m != "*" && m != meta.ETag)) {
+		return false
+	}
+
+	if m := req.Header.Get(ifNoneMatch); m != "" && meta != nil && (m == "*" || m == meta.ETag) {
+		return false
+	}
+
+	return true
+}
+
+// putObject serves PutObject requests.
+func (t *Transport) putObject(req *http.Request, bucket, key string) (*http.Response, error) {
+	var data []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	}
+
+	prev, err := t.stat(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !checkPreconditions(req, prev, "If-Match", "If-None-Match") {
+		return errorResponse(req, http.StatusPreconditionFailed, "PreconditionFailed", "at least one of the preconditions you specified did not hold")
+	}
+
+	meta := &metadata{
+		ETag:            etag(data),
+		ContentType:     req.Header.Get("Content-Type"),
+		ContentEncoding: req.Header.Get("Content-Encoding"),
+		Metadata:        userMetadata(req.Header),
+		LastModified:    time.Now().UTC(),
+	}
+
+	if err := t.write(bucket, key, data, meta); err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("ETag", meta.ETag)
+
+	return response(req, http.StatusOK, header, nil)
+}
+
+// copyObject serves CopyObject requests.
+func (t *Transport) copyObject(req *http.Request, bucket, key string) (*http.Response, error) {
+	src, err := url.PathUnescape(req.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return errorResponse(req, http.StatusBadRequest, "InvalidArgument", "invalid copy source")
+	}
+
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+	srcKey, _, _ = strings.Cut(srcKey, "?")
+	if _, err := os.Stat(filepath.Join(t.Root, srcBucket)); err != nil {
+		return errorResponse(req, http.StatusNotFound, "NoSuchBucket", "the source bucket does not exist")
+	}
+
+	meta, err := t.stat(srcBucket, srcKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta == nil {
+		return errorResponse(req, http.StatusNotFound, "NoSuchKey", "the specified key does not exist")
+	}
+
+	if !checkPreconditions(req, meta, "X-Amz-Copy-Source-If-Match", "X-Amz-Copy-Source-If-None-Match") {
+		return errorResponse(req, http.StatusPreconditionFailed, "PreconditionFailed", "at least one of the preconditions you specified did not hold")
+	}
+
+	data, err := os.ReadFile(t.objectPath(srcBucket, srcKey))
+	if err != nil {
+		return nil, err
+	}
+
+	cp := *meta
+	cp.LastModified = time.Now().UTC()
+	if req.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		cp.ContentType = req.Header.Get("Content-Type")
+		cp.ContentEncoding = req.Header.Get("Content-Encoding")
+		cp.Metadata = userMetadata(req.Header)
+	}
+
+	if err := t.write(bucket, key, data, &cp); err != nil {
+		return nil, err
+	}
+
+	res := struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		ETag         string   `xml:"ETag"`
+		LastModified string   `xml:"LastModified"`
+	}{
+		ETag:         cp.ETag,
+		LastModified: cp.LastModified.Format(time.RFC3339),
+	}
+
+	return xmlResponse(req, http.StatusOK, res)
+}
+
+// deleteObject serves DeleteObject requests. Deleting a missing object
+// succeeds, as in S3.
+func (t *Transport) deleteObject(req *http.Request, bucket, key string) (*http.Response, error) {
+	for _, p := range []string{t.objectPath(bucket, key), t.metadataPath(bucket, key)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		t.prune(p)
+	}
+
+	return response(req, http.StatusNoContent, nil, nil)
+}
+
+// write stores an object's data and metadata. Data is written to a
+// temporary file first, so readers never see partial objects.
+func (t *Transport) write(bucket, key string, data []byte, meta *metadata) error {
+	enc, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	for p, b := range map[string][]byte{t.objectPath(bucket, key): data, t.metadataPath(bucket, key): enc} {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return err
+		}
+
+		tmp := filepath.Join(t.Root, ".tmp")
+		if err := os.MkdirAll(tmp, 0o755); err != nil {
+			return err
+		}
+
+		f, err := os.CreateTemp(tmp, "object-")
+		if err != nil {
+			return err
+		}
+
+		if _, err := f.Write(b); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+
+		if err := f.Close(); err != nil {
+			os.Remove(f.Name())
+			return err
+		}
+
+		if err := os.Rename(f.Name(), p); err != nil {
+			os.Remove(f.Name())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// prune removes the empty parent directories of a deleted object, up to
+// the root of its bucket.
+func (t *Transport) prune(p string) {
+	for dir := filepath.Dir(p); ; dir = filepath.Dir(dir) {
+		rel, err := filepath.Rel(t.Root, dir)
+		if err != nil || !strings.Contains(filepath.ToSlash(rel), "/") {
+			return
+		}
+
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
+
+// listObjects serves ListObjectsV2 requests.
+func (t *Transport) listObjects(req *http.Request, bucket string, query url.Values) (*http.Response, error) {
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+
+	maxKeys := ListMaxKeysDefault
+	if s := query.Get("max-keys"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return errorResponse(req, http.StatusBadRequest, "InvalidArgument", "invalid max-keys")
+		}
+		maxKeys = n
+	}
+
+	after := query.Get("start-after")
+	if token := query.Get("continuation-token"); token != "" {
+		after = token
+	}
+
+	// Walk the deepest directory that holds every key with the prefix
+	base := filepath.Join(t.Root, bucket)
+	dir := base
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = filepath.Join(base, filepath.FromSlash(prefix[:i]))
+	}
+
+	var keys []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys are returned in byte order, as in S3
+	sort.Strings(keys)
+
+	type object struct {
+		Key          string `xml:"Key"`
+		LastModified string `xml:"LastModified"`
+		ETag         string `xml:"ETag"`
+		Size         int64  `xml:"Size"`
+		StorageClass string `xml:"StorageClass"`
+	}
+
+	type commonPrefix struct {
+		Prefix string `xml:"Prefix"`
+	}
+
+	res := struct {
+		XMLName               xml.Name       `xml:"ListBucketResult"`
+		Name                  string         `xml:"Name"`
+		Prefix                string         `xml:"Prefix"`
+		Delimiter             string         `xml:"Delimiter,omitempty"`
+		StartAfter            string         `xml:"StartAfter,omitempty"`
+		ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+		MaxKeys               int            `xml:"MaxKeys"`
+		KeyCount              int            `xml:"KeyCount"`
+		IsTruncated           bool           `xml:"IsTruncated"`
+		NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+		Contents              []object       `xml:"Contents"`
+		CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+	}{
+		Name:              bucket,
+		Prefix:            prefix,
+		Delimiter:         delimiter,
+		StartAfter:        query.Get("start-after"),
+		ContinuationToken: query.Get("continuation-token"),
+		MaxKeys:           maxKeys,
+	}
+
+	last := ""
+	for _, key := range keys {
+		if key <= after {
+			continue
+		}
+
+		// Keys below the delimiter are rolled up into common prefixes
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				cp := key[:len(prefix)+i+len(delimiter)]
+				if cp <= after || cp == last {
+					continue
+				}
+
+				if res.KeyCount == maxKeys {
+					res.IsTruncated = true
+					break
+				}
+
+				res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: cp})
+				res.KeyCount++
+				last = cp
+				continue
+			}
+		}
+
+		if res.KeyCount == maxKeys {
+			res.IsTruncated = true
+			break
+		}
+
+		meta, err := t.stat(bucket, key)
+		if err != nil {
+			return nil, err
+		}
+
+		fi, err := os.Stat(t.objectPath(bucket, key))
+		if err != nil {
+			return nil, err
+		}
+
+		res.Contents = append(res.Contents, object{
+			Key:          key,
+			LastModified: meta.LastModified.UTC().Format(time.RFC3339),
+			ETag:         meta.ETag,
+			Size:         fi.Size(),
+			StorageClass: "STANDARD",
+		})
+		res.KeyCount++
+		last = key
+	}
+
+	if res.IsTruncated {
+		// Common prefixes are skipped past as a whole when resuming
+		res.NextContinuationToken = last
+		if strings.HasSuffix(last, delimiter) && delimiter != "" {
+			res.NextContinuationToken = last + "￿"
+		}
+	}
+
+	return xmlResponse(req, http.StatusOK, res)
+}
+
+// userMetadata returns the user-defined metadata of a request.
+func userMetadata(header http.Header) map[string]string {
+	meta := map[string]string{}
+	for k, v := range header {
+		if name, ok := strings.CutPrefix(strings.ToLower(k), "x-amz-meta-"); ok && len(v) > 0 {
+			meta[name] = v[0]
+		}
+	}
+
+	if len(meta) == 0 {
+		return nil
+	}
+
+	return meta
+}
+
+// etag returns the ETag of an object's data, which is its quoted md5 hash.
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// response returns an HTTP response to the given request.
+func response(req *http.Request, status int, header http.Header, body []byte) (*http.Response, error) {
+	if header == nil {
+		header = http.Header{}
+	}
+
+	if header.Get("Content-Length") == "" {
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// xmlResponse returns an HTTP response with an XML body.
+func xmlResponse(req *http.Request, status int, v interface{}) (*http.Response, error) {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml")
+
+	return response(req, status, header, append([]byte(xml.Header), b...))
+}
+
+// errorResponse returns an S3 error response. Responses to HEAD requests
+// have no body, as in S3.
+func errorResponse(req *http.Request, status int, code, message string) (*http.Response, error) {
+	if req.Method == http.MethodHead {
+		return response(req, status, nil, nil)
+	}
+
+	res := struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{
+		Code:    code,
+		Message: message,
+	}
+
+	return xmlResponse(req, status, res)
+}
@@ -0,0 +1,59 @@
+package pomdb
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// discardHandler is a slog.Handler that drops every record, so the client
+// is silent unless a Logger is set.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (d discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return d }
+func (d discardHandler) WithGroup(string) slog.Handler           { return d }
+
+var discardLogger = slog.New(discardHandler{})
+
+// operationKey is the context key of the operation being performed.
+type operationKey struct{}
+
+// logger returns the client's logger.
+func (c *Client) logger() *slog.Logger {
+	if c.Logger == nil {
+		return discardLogger
+	}
+
+	return c.Logger
+}
+
+// logDebug writes a debug record to the client's logger, attributed to the
+// operation being performed.
+func (c *Client) logDebug(msg string, args ...any) {
+	ctx := c.context()
+
+	l := c.logger()
+	if !l.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	if op, ok := ctx.Value(operationKey{}).(*Operation); ok {
+		args = append([]any{"op", op.Name}, args...)
+	}
+
+	l.DebugContext(ctx, msg, args...)
+}
+
+// redactKey replaces the encoded value in index item keys, which may hold
+// personal data such as email addresses. Encoded values may contain
+// slashes, so everything between the field and the ID is replaced.
+func redactKey(key string) string {
+	parts := strings.Split(key, "/")
+	if len(parts) >= 6 && (parts[1] == "indexes" || parts[1] == "trash") {
+		parts = append(parts[:4], "REDACTED", parts[len(parts)-1])
+	}
+
+	return strings.Join(parts, "/")
+}
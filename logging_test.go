@@ -0,0 +1,56 @@
+package pomdb_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/pomdb/pomdb-go"
+)
+
+func TestLoggingRedactsIndexValues(t *testing.T) {
+	var buf bytes.Buffer
+
+	c := newTestClient(t)
+	c.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	// The encoded value contains a slash
+	email := ">>?@example.com"
+	enc := base64.StdEncoding.EncodeToString([]byte(email))
+	if !strings.Contains(enc, "/") {
+		t.Fatalf("encoded value %s has no slash", enc)
+	}
+
+	a := &account{Email: email}
+	if _, err := c.Create(a); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Delete(a); err != nil {
+		t.Fatal(err)
+	}
+
+	// Errors of lookups are logged too
+	_, err := c.FindOne(pomdb.Query{Model: &account{}, Field: "email", Value: email})
+	if !errors.Is(err, pomdb.ErrNotFound) {
+		t.Fatalf("FindOne of a deleted record: %v", err)
+	}
+
+	if strings.Contains(err.Error(), email) {
+		t.Errorf("error holds the index value: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "indexes/unique/email/REDACTED/"+a.ID.String()) {
+		t.Errorf("no redacted index item key in:\n%s", out)
+	}
+
+	for _, v := range []string{email, enc, "Pj4"} {
+		if strings.Contains(out, v) {
+			t.Errorf("log holds %s:\n%s", v, out)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package pomdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// LayoutVersion is the version of the bucket layout described by
+// collection manifests. It changes when the way records or index items are
+// stored changes incompatibly.
+const LayoutVersion int = 1
+
+// CollectionManifest describes a collection, so that tools and other
+// languages can interpret the objects stored in it. Manifests are stored
+// under _pomdb/collections/{name}.json.
+type CollectionManifest struct {
+	// Layout is the bucket layout version the collection is stored with.
+	Layout int `json:"layout"`
+
+	// Name is the name of the collection.
+	Name string `json:"name"`
+
+	// Fields are the fields of the collection's records.
+	Fields []FieldManifest `json:"fields"`
+
+	// Codec is the content type records are written with. Records written
+	// with other codecs record their own content type.
+	Codec string `json:"codec"`
+
+	// Compression is the algorithm record bodies are compressed with.
+	Compression Compression `json:"compression,omitempty"`
+
+	// History reports whether versions of records are kept.
+	History bool `json:"history,omitempty"`
+
+	// Changelog reports whether changes to records are logged.
+	Changelog bool `json:"changelog,omitempty"`
+
+	// TTL is the number of seconds after which records expire.
+	TTL int64 `json:"ttl,omitempty"`
+
+	// SchemaVersion is the version of the last migration applied.
+	SchemaVersion int `json:"schema_version"`
+
+	// UpdatedAt is the time the manifest was last written.
+	UpdatedAt Timestamp `json:"updated_at"`
+}
+
+// FieldManifest describes a field of a collection's records.
+type FieldManifest struct {
+	// Name is the field's name in stored records.
+	Name string `json:"name"`
+
+	// Type is the field's type: string, int, uint, float, bool, ulid,
+	// timestamp, time, bytes, array or object.
+	Type string `json:"type"`
+
+	// Role is the field's managed role, if any: id, created_at, updated_at,
+	// deleted_at or ttl.
+	Role string `json:"role,omitempty"`
+
+	// Index is the field's index type, if it is indexed: unique, shared or
+	// ranged. Its index items are stored under the field's json tag.
+	Index string `json:"index,omitempty"`
+
+	// Encrypted reports whether the field is encrypted.
+	Encrypted bool `json:"encrypted,omitempty"`
+}
+
+// String returns the name of the index type, as used in index keys.
+func (t IndexType) String() string {
+	switch t {
+	case UniqueIndex:
+		return "unique"
+	case SharedIndex:
+		return "shared"
+	case RangedIndex:
+		return "ranged"
+	default:
+		return fmt.Sprintf("IndexType(%d)", int(t))
+	}
+}
+
+// encodeManifestKey returns the key of a collection's manifest.
+func encodeManifestKey(collection string) string {
+	return "_pomdb/collections/" + collection + ".json"
+}
+
+// Collections returns the manifests of the collections in the bucket,
+// ordered by name.
+func (c *Client) Collections(ctx context.Context) ([]CollectionManifest, error) {
+	c = c.WithContext(ctx)
+
+	objs, err := c.listObjects("_pomdb/collections/")
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []CollectionManifest
+	for _, obj := range objs {
+		name := strings.TrimSuffix(strings.TrimPrefix(*obj.Key, "_pomdb/collections/"), ".json")
+
+		m, err := c.getManifest(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if m != nil {
+			manifests = append(manifests, *m)
+		}
+	}
+
+	return manifests, nil
+}
+
+// Collection returns the manifest of the named collection.
+func (c *Client) Collection(ctx context.Context, name string) (*CollectionManifest, error) {
+	c = c.WithContext(ctx)
+
+	m, err := c.getManifest(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if m == nil {
+		return nil, fmt.Errorf("[Error] Collection: %w: collection %s has no manifest", ErrNotFound, name)
+	}
+
+	return m, nil
+}
+
+// newManifest describes the collection of the cached model.
+func (c *Client) newManifest(ca *ModelCache) (*CollectionManifest, error) {
+	opts := c.options(ca.Collection)
+
+	st, _, err := c.getMigrationState(ca.Collection)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &CollectionManifest{
+		Layout:        LayoutVersion,
+		Name:          ca.Collection,
+		Codec:         c.codec(ca.Collection).ContentType(),
+		Compression:   opts.Compression,
+		History:       opts.History,
+		Changelog:     opts.Changelog,
+		TTL:           int64(opts.TTL / time.Second),
+		SchemaVersion: st.SchemaVersion,
+	}
+
+	indexes := make(map[string]IndexField)
+	for _, idx := range ca.IndexFields {
+		indexes[idx.FieldName] = idx
+	}
+
+	rt := reflect.TypeOf(ca.Reference).Elem()
+	for _, f := range manifestFields(rt) {
+		fm := FieldManifest{
+			Name: jsonName(f),
+			Type: fieldTypeName(f.Type),
+		}
+
+		pmtag := f.Tag.Get("pomdb")
+		for _, role := range []string{"id", "created_at", "updated_at", "deleted_at", "ttl"} {
+			if tagContains(pmtag, []string{role}) {
+				fm.Role = role
+			}
+		}
+
+		if idx, ok := indexes[f.Tag.Get("json")]; ok {
+			fm.Index = idx.IndexType.String()
+		}
+
+		fm.Encrypted = tagContains(pmtag, []string{"encrypted"})
+		m.Fields = append(m.Fields, fm)
+	}
+
+	return m, nil
+}
+
+// manifestFields returns the stored fields of a model type, including the
+// fields of an embedded pomdb.Model.
+func manifestFields(rt reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for j := 0; j < rt.NumField(); j++ {
+		f := rt.Field(j)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, manifestFields(f.Type)...)
+			continue
+		}
+
+		if !f.IsExported() || f.Tag.Get("json") == "-" {
+			continue
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+// fieldTypeName returns the manifest type name of a field type.
+func fieldTypeName(t reflect.Type) string {
+	switch t {
+	case reflect.TypeOf(ULID{}):
+		return "ulid"
+	case reflect.TypeOf(Timestamp{}):
+		return "timestamp"
+	case reflect.TypeOf(time.Time{}):
+		return "time"
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return fieldTypeName(t.Elem())
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "uint"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "bytes"
+		}
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// writeManifest stores the manifest of the cached model's collection,
+// unless the stored manifest already describes it.
+func (c *Client) writeManifest(ca *ModelCache) error {
+	m, err := c.newManifest(ca)
+	if err != nil {
+		return err
+	}
+
+	prev, err := c.getManifest(ca.Collection)
+	if err != nil {
+		return err
+	}
+
+	if prev != nil {
+		m.UpdatedAt = prev.UpdatedAt
+		if reflect.DeepEqual(m, prev) {
+			return nil
+		}
+	}
+
+	m.UpdatedAt = NewTimestamp()
+
+	enc, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	put := &s3.PutObjectInput{
+		Bucket:      &c.Bucket,
+		Key:         aws.String(encodeManifestKey(ca.Collection)),
+		Body:        bytes.NewReader(enc),
+		ContentType: aws.String("application/json"),
+	}
+
+	if _, err := c.Service.PutObject(c.context(), put, c.apiOptions()...); err != nil {
+		return fmt.Errorf("[Error] writeManifest: %w", err)
+	}
+
+	c.logDebug("wrote manifest", "collection", ca.Collection)
+
+	return nil
+}
+
+// getManifest fetches the manifest of a collection, or nil if it has none.
+func (c *Client) getManifest(collection string) (*CollectionManifest, error) {
+	get := &s3.GetObjectInput{
+		Bucket: &c.Bucket,
+		Key:    aws.String(encodeManifestKey(collection)),
+	}
+
+	var noSuchKey *types.NoSuchKey
+	obj, err := c.Service.GetObject(c.context(), get, c.apiOptions()...)
+	if err != nil && errors.As(err, &noSuchKey) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+
+	m := &CollectionManifest{}
+	if err := json.NewDecoder(obj.Body).Decode(m); err != nil {
+		return nil, fmt.Errorf("[Error] getManifest: %w", err)
+	}
+
+	return m, nil
+}
@@ -0,0 +1,130 @@
+package pomdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Operation describes a client operation as it passes through middleware.
+// Middleware may replace its Context and its inputs, from Model onwards,
+// before calling the next handler. Name and Collection describe the
+// operation, and are read-only: the collection is that of the model, so
+// an operation is directed at another collection by replacing its model.
+type Operation struct {
+	// Context is the context the operation runs with.
+	Context context.Context
+
+	// Name is the name of the client method, e.g. "Create" or "FindMany".
+	Name string
+
+	// Collection is the name of the model's collection.
+	Collection string
+
+	// Model is the model passed to the operation, or the query's model.
+	Model interface{}
+
+	// Query is the query of FindOne, FindMany, and FindAll operations.
+	Query *Query
+
+	// ID is the record ID of Patch operations.
+	ID string
+
+	// Field is the field Upsert operations match records on.
+	Field string
+
+	// Fields are the changes applied by Patch operations.
+	Fields map[string]any
+
+	// Version is the version Revert operations restore.
+	Version string
+}
+
+// Handler performs an operation and returns its result, which has the type
+// returned by the corresponding client method.
+type Handler func(op *Operation) (interface{}, error)
+
+// Middleware wraps a Handler with additional behaviour. Middleware can
+// inspect or modify the operation, short-circuit it by returning without
+// calling next, or observe the result and error returned by next.
+type Middleware func(next Handler) Handler
+
+// Use adds middleware around the client's operations. Middleware runs in
+// the order it is added, so the first middleware is the outermost. Use is
+// not safe for concurrent use, and should be called before the client is
+// used.
+func (c *Client) Use(mw ...Middleware) {
+	c.middleware = append(c.middleware, mw...)
+}
+
+// invoke runs an operation through the client's middleware, and finally
+// through fn, which runs with the operation's context.
+func (c *Client) invoke(op *Operation, fn func(c *Client, op *Operation) (interface{}, error)) (interface{}, error) {
+	op.Context = c.context()
+
+	if op.Collection == "" {
+		op.Collection = collectionOf(op.Model)
+	}
+
+	var h Handler = func(op *Operation) (interface{}, error) {
+		ctx := context.WithValue(op.Context, operationKey{}, op)
+		return fn(c.WithContext(ctx), op)
+	}
+
+	for k := len(c.middleware) - 1; k >= 0; k-- {
+		h = c.middleware[k](h)
+	}
+
+	start := time.Now()
+	end := c.startOperation(op)
+	res, err := h(op)
+	end(err)
+
+	// Log the operation
+	args := []any{"op", op.Name, "collection", op.Collection, "latency", time.Since(start)}
+	if err != nil && errors.Is(err, ErrNotFound) {
+		// Missing records are an expected outcome of lookups
+		c.logger().DebugContext(op.Context, "operation failed", append(args, "error", err)...)
+	} else if err != nil {
+		c.logger().WarnContext(op.Context, "operation failed", append(args, "error", err)...)
+	} else {
+		c.logger().DebugContext(op.Context, "operation", args...)
+	}
+
+	return res, err
+}
+
+// invokeETag runs an operation that returns an ETag or ID.
+func (c *Client) invokeETag(op *Operation, fn func(c *Client, op *Operation) (interface{}, error)) (*string, error) {
+	return invokeAs[*string](c, op, fn)
+}
+
+// invokeAs runs an operation and returns its result as T. Middleware that
+// returns a result of another type causes an error.
+func invokeAs[T any](c *Client, op *Operation, fn func(c *Client, op *Operation) (interface{}, error)) (T, error) {
+	res, err := c.invoke(op, fn)
+
+	out, ok := res.(T)
+	if !ok && res != nil {
+		return out, fmt.Errorf("[Error] %s: middleware returned a %T result, want %T", op.Name, res, out)
+	}
+
+	return out, err
+}
+
+// collectionOf returns the collection name of a model, or an empty string
+// if it is not a valid model.
+func collectionOf(model interface{}) string {
+	rv := reflect.ValueOf(model)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return ""
+	}
+
+	return collectionName(rv.Type())
+}
@@ -0,0 +1,325 @@
+package pomdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// MigrationBatchSizeDefault is the number of records Migrate rewrites
+// between checkpoints.
+const MigrationBatchSizeDefault int = 100
+
+// Migration rewrites the records of a collection to a new schema version.
+// Up receives each record as a document, keyed by json field name and
+// holding values as decoded by the record's codec, and changes it in place.
+// The document is stored as Up leaves it, so keys the model does not have
+// are kept, e.g. for a later model version to read.
+// Migrations may run more than once for a record, e.g. for records created
+// while they run, so Up should leave migrated documents unchanged.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, doc map[string]interface{}) error
+}
+
+// migrationState is the schema version of a collection, along with the
+// progress of the migration being applied to it.
+type migrationState struct {
+	SchemaVersion int                  `json:"schema_version"`
+	Checkpoint    *migrationCheckpoint `json:"checkpoint,omitempty"`
+}
+
+// migrationCheckpoint is the last record a migration was applied to.
+type migrationCheckpoint struct {
+	Version int    `json:"version"`
+	After   string `json:"after"`
+}
+
+// encodeMigrationKey returns the key of a collection's migration state.
+func encodeMigrationKey(collection string) string {
+	return "_pomdb/migrations/" + collection + ".json"
+}
+
+// SchemaVersion returns the schema version of a collection, which is the
+// version of the last migration applied to it.
+func (c *Client) SchemaVersion(ctx context.Context, model interface{}) (int, error) {
+	c = c.WithContext(ctx)
+
+	// Dereference the input
+	rv, err := dereferenceStruct(model)
+	if err != nil {
+		return 0, err
+	}
+
+	st, _, err := c.getMigrationState(collectionName(rv.Type()))
+	if err != nil {
+		return 0, err
+	}
+
+	return st.SchemaVersion, nil
+}
+
+// Migrate applies the collection's pending migrations, in order of version,
+// and returns the collection's schema version. Records are migrated in
+// batches, and progress is checkpointed after each batch, so an interrupted
+// run resumes where it stopped.
+func (c *Client) Migrate(ctx context.Context, model interface{}) (int, error) {
+	c = c.WithContext(ctx)
+
+	// Dereference the input
+	rv, err := dereferenceStruct(model)
+	if err != nil {
+		return 0, err
+	}
+
+	// Build the struct cache
+	ca := NewModelCache(rv)
+
+	// Sort the migrations by version
+	migrations := append([]Migration(nil), c.options(ca.Collection).Migrations...)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	st, etag, err := c.getMigrationState(ca.Collection)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range migrations {
+		if m.Version <= st.SchemaVersion {
+			continue
+		}
+
+		// Resume from the checkpoint of an interrupted run
+		after := ""
+		if st.Checkpoint != nil && st.Checkpoint.Version == m.Version {
+			after = st.Checkpoint.After
+		}
+
+		// Claim the migration before changing any record, so concurrent
+		// runs conflict before either migrates a batch
+		st.Checkpoint = &migrationCheckpoint{Version: m.Version, After: after}
+		if etag, err = c.putMigrationState(ca.Collection, st, etag); err != nil {
+			return st.SchemaVersion, err
+		}
+
+		for {
+			if err := ctx.Err(); err != nil {
+				return st.SchemaVersion, err
+			}
+
+			last, err := c.migrateBatch(ca, m, after)
+			if err != nil {
+				return st.SchemaVersion, fmt.Errorf("[Error] Migrate: migration %d (%s): %w", m.Version, m.Name, err)
+			}
+
+			if last == "" {
+				break
+			}
+
+			after = last
+			st.Checkpoint = &migrationCheckpoint{Version: m.Version, After: after}
+			if etag, err = c.putMigrationState(ca.Collection, st, etag); err != nil {
+				return st.SchemaVersion, err
+			}
+		}
+
+		st.SchemaVersion = m.Version
+		st.Checkpoint = nil
+		if etag, err = c.putMigrationState(ca.Collection, st, etag); err != nil {
+			return st.SchemaVersion, err
+		}
+
+		// Record the new schema version in the collection's manifest
+		if err := c.writeManifest(ca); err != nil {
+			return st.SchemaVersion, err
+		}
+	}
+
+	return st.SchemaVersion, nil
+}
+
+// migrateBatch applies a migration to the next batch of records after the
+// given key, and returns the key of the last record in the batch, or an
+// empty string if there were none.
+func (c *Client) migrateBatch(ca *ModelCache, m Migration, after string) (string, error) {
+	pfx := ca.Collection + "/"
+
+	lst := &s3.ListObjectsV2Input{
+		Bucket:    &c.Bucket,
+		Prefix:    &pfx,
+		Delimiter: aws.String("/"),
+		MaxKeys:   aws.Int32(int32(MigrationBatchSizeDefault)),
+	}
+
+	if after != "" {
+		lst.StartAfter = &after
+	}
+
+	res, err := c.Service.ListObjectsV2(c.context(), lst, c.apiOptions()...)
+	if err != nil {
+		return "", err
+	}
+
+	last := ""
+	for _, obj := range res.Contents {
+		if err := c.migrateRecord(ca, m, *obj.Key); err != nil {
+			return "", err
+		}
+
+		last = *obj.Key
+	}
+
+	return last, nil
+}
+
+// migrateRecord applies a migration to the record stored at key, retrying
+// if the record is modified concurrently.
+func (c *Client) migrateRecord(ca *ModelCache, m Migration, key string) error {
+	for attempt := 0; attempt <= PatchRetriesDefault; attempt++ {
+		get := &s3.GetObjectInput{
+			Bucket: &c.Bucket,
+			Key:    &key,
+		}
+
+		var noSuchKey *types.NoSuchKey
+		obj, err := c.Service.GetObject(c.context(), get, c.apiOptions()...)
+		if err != nil && errors.As(err, &noSuchKey) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		codec, body, err := c.readRecord(ca, key, obj)
+		if err != nil {
+			return err
+		}
+
+		// Decode the record as it was stored
+		prev := reflect.New(reflect.TypeOf(ca.Reference).Elem()).Interface()
+		if err := codec.Unmarshal(body, prev); err != nil {
+			return err
+		}
+
+		// Apply the migration to the record's document
+		doc := map[string]interface{}{}
+		if err := decodeDocument(codec, body, &doc); err != nil {
+			return err
+		}
+
+		if err := m.Up(c.context(), doc); err != nil {
+			return err
+		}
+
+		enc, err := codec.Marshal(doc)
+		if err != nil {
+			return err
+		}
+
+		model := reflect.New(reflect.TypeOf(ca.Reference).Elem()).Interface()
+		if err := codec.Unmarshal(enc, model); err != nil {
+			return err
+		}
+
+		// Update the record's indexes, unless it is soft-deleted
+		mc := NewModelCache(reflect.ValueOf(model).Elem())
+		trashed, err := c.isTrashed(mc)
+		if err != nil {
+			return err
+		}
+
+		diff := !trashed && len(mc.IndexFields) > 0 && mc.CompareIndexFields(prev)
+		if diff {
+			if err := c.CheckIndexExists(mc); err != nil {
+				return err
+			}
+		}
+
+		// Store the migrated document, rather than the model, so keys the
+		// model does not have are kept
+		_, err = c.putRecord(mc, doc, ifMatch(obj.ETag))
+		if err != nil && errors.Is(err, ErrConflict) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err := c.appendChange(mc, ChangeUpdate, doc); err != nil {
+			return err
+		}
+
+		if diff {
+			return c.UpdateIndexItems(mc)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("[Error] Migrate: %w: key=%s", ErrConflict, key)
+}
+
+// getMigrationState fetches the migration state of a collection.
+func (c *Client) getMigrationState(collection string) (*migrationState, *string, error) {
+	get := &s3.GetObjectInput{
+		Bucket: &c.Bucket,
+		Key:    aws.String(encodeMigrationKey(collection)),
+	}
+
+	var noSuchKey *types.NoSuchKey
+	obj, err := c.Service.GetObject(c.context(), get, c.apiOptions()...)
+	if err != nil && errors.As(err, &noSuchKey) {
+		return &migrationState{}, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	defer obj.Body.Close()
+
+	st := &migrationState{}
+	if err := json.NewDecoder(obj.Body).Decode(st); err != nil {
+		return nil, nil, err
+	}
+
+	return st, obj.ETag, nil
+}
+
+// putMigrationState stores the migration state of a collection. The write
+// is conditional on the state being unchanged since it was read, or on
+// there being no state if none was read, so that concurrent runs do not
+// interleave.
+func (c *Client) putMigrationState(collection string, st *migrationState, etag *string) (*string, error) {
+	enc, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+
+	put := &s3.PutObjectInput{
+		Bucket:      &c.Bucket,
+		Key:         aws.String(encodeMigrationKey(collection)),
+		Body:        bytes.NewReader(enc),
+		ContentType: aws.String("application/json"),
+	}
+
+	optFns := []func(*s3.Options){ifNoneMatch()}
+	if etag != nil {
+		optFns = []func(*s3.Options){ifMatch(etag)}
+	}
+
+	res, err := c.Service.PutObject(c.context(), put, c.apiOptions(optFns...)...)
+	if err != nil && isPreconditionFailed(err) {
+		return nil, fmt.Errorf("[Error] Migrate: %w: migration state of %s was changed by another run: %w", ErrConflict, collection, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return res.ETag, nil
+}
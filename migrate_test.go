@@ -0,0 +1,61 @@
+package pomdb_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/pomdb/pomdb-go"
+)
+
+func TestMigrateClaimsBeforeMigrating(t *testing.T) {
+	c := newTestClient(t)
+
+	if _, err := c.Create(&account{Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var migrated atomic.Int32
+	err := c.Register(&account{}, pomdb.CollectionOptions{Migrations: []pomdb.Migration{{
+		Version: 1,
+		Up: func(ctx context.Context, doc map[string]interface{}) error {
+			migrated.Add(1)
+			return nil
+		},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another run claims the migration after this one reads the state
+	svc := c.Service
+	c.Service = s3.New(svc.Options(), s3.WithAPIOptions(func(st *middleware.Stack) error {
+		return st.Initialize.Add(middleware.InitializeMiddlewareFunc("race", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			if put, ok := in.Parameters.(*s3.PutObjectInput); ok && *put.Key == "_pomdb/migrations/accounts.json" {
+				claim := &s3.PutObjectInput{
+					Bucket: put.Bucket,
+					Key:    put.Key,
+					Body:   strings.NewReader(`{"schema_version":0,"checkpoint":{"version":1,"after":""}}`),
+				}
+
+				if _, err := svc.PutObject(ctx, claim); err != nil {
+					return middleware.InitializeOutput{}, middleware.Metadata{}, err
+				}
+			}
+
+			return next.HandleInitialize(ctx, in)
+		}), middleware.After)
+	}))
+
+	if _, err := c.Migrate(context.Background(), &account{}); !errors.Is(err, pomdb.ErrConflict) {
+		t.Fatalf("Migrate = %v, want ErrConflict", err)
+	}
+
+	if n := migrated.Load(); n != 0 {
+		t.Errorf("migrated %d records, want none", n)
+	}
+}
@@ -1,6 +1,7 @@
 package pomdb
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -35,6 +36,21 @@ func NewULID() ULID {
 	return ULID(ulid.Make())
 }
 
+// ParseULID parses a ULID from its string representation.
+func ParseULID(s string) (ULID, error) {
+	id, err := ulid.Parse(s)
+	if err != nil {
+		return ULID{}, ErrInvalidHex
+	}
+
+	return ULID(id), nil
+}
+
+// IsZero returns true if the ULID is the zero value.
+func (id ULID) IsZero() bool {
+	return id == ULID{}
+}
+
 func (id ULID) String() string {
 	return ulid.ULID(id).String()
 }
@@ -60,6 +76,16 @@ func (id *ULID) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// MarshalBinary encodes the ULID as its 16 bytes, for binary codecs.
+func (id ULID) MarshalBinary() ([]byte, error) {
+	return ulid.ULID(id).MarshalBinary()
+}
+
+// UnmarshalBinary populates the ULID from its 16 bytes.
+func (id *ULID) UnmarshalBinary(b []byte) error {
+	return (*ulid.ULID)(id).UnmarshalBinary(b)
+}
+
 type Timestamp time.Time
 
 func NewTimestamp() Timestamp {
@@ -86,6 +112,22 @@ func (ts *Timestamp) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// MarshalBinary encodes the Timestamp as big-endian Unix seconds, for
+// binary codecs.
+func (ts Timestamp) MarshalBinary() ([]byte, error) {
+	return binary.BigEndian.AppendUint64(nil, uint64(time.Time(ts).Unix())), nil
+}
+
+// UnmarshalBinary populates the Timestamp from big-endian Unix seconds.
+func (ts *Timestamp) UnmarshalBinary(b []byte) error {
+	if len(b) != 8 {
+		return errors.New("[Error] Timestamp: invalid binary length")
+	}
+
+	*ts = Timestamp(time.Unix(int64(binary.BigEndian.Uint64(b)), 0))
+	return nil
+}
+
 // UnmarshalText populates the Timestamp from a text representation.
 func (ts *Timestamp) UnmarshalText(b []byte) error {
 	i, err := strconv.ParseInt(string(b), 10, 64)
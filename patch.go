@@ -0,0 +1,307 @@
+package pomdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// PatchRetriesDefault is the number of times Patch re-reads and re-applies
+// its changes when the record is modified concurrently.
+const PatchRetriesDefault int = 3
+
+type patchOp int
+
+const (
+	patchIncrement patchOp = iota
+	patchAppend
+	patchRemove
+)
+
+// PatchOperator is an operation applied to the current value of a field by
+// Patch, rather than a value that replaces it.
+type PatchOperator struct {
+	op     patchOp
+	values []interface{}
+}
+
+// Increment adds n to a numeric field.
+func Increment(n interface{}) PatchOperator {
+	return PatchOperator{op: patchIncrement, values: []interface{}{n}}
+}
+
+// Append adds values to the end of an array field.
+func Append(values ...interface{}) PatchOperator {
+	return PatchOperator{op: patchAppend, values: values}
+}
+
+// Remove removes every occurrence of values from an array field.
+func Remove(values ...interface{}) PatchOperator {
+	return PatchOperator{op: patchRemove, values: values}
+}
+
+// Patch applies a set of field changes to the record with the given ID,
+// without replacing the fields it does not mention. Changes are keyed by
+// json field name and follow RFC 7396 merge-patch semantics: a nil value
+// removes the field, a map is merged into an object field, and any other
+// value replaces the field. A PatchOperator modifies the field's current
+// value instead. The write is conditional on the record being unchanged
+// since it was read, and is retried against the latest version otherwise.
+// On success, the model holds the patched record.
+func (c *Client) Patch(i interface{}, id string, fields map[string]any) (*string, error) {
+	return c.invokeETag(&Operation{Name: "Patch", Model: i, ID: id, Fields: fields}, func(c *Client, op *Operation) (interface{}, error) {
+		return c.patch(op.Model, op.ID, op.Fields)
+	})
+}
+
+// patch implements Patch.
+func (c *Client) patch(i interface{}, id string, fields map[string]any) (*string, error) {
+	// Dereference the input
+	rv, err := dereferenceStruct(i)
+	if err != nil {
+		return nil, err
+	}
+
+	// Managed fields cannot be patched
+	for k := range fields {
+		if managedTags[k] {
+			return nil, fmt.Errorf("[Error] Patch: field %s is managed by pomdb", k)
+		}
+	}
+
+	// Normalize the changes to their json representation
+	changes, err := normalizePatch(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only valid IDs address records, rather than other objects of the
+	// collection
+	uid, err := ParseULID(id)
+	if err != nil {
+		return nil, fmt.Errorf("[Error] Patch: %w: invalid id %q: %w", ErrNotFound, id, err)
+	}
+
+	// Get the record's key
+	key := NewModelCache(rv).Collection + "/" + uid.String()
+
+	for attempt := 0; attempt <= PatchRetriesDefault; attempt++ {
+		// Build the struct cache
+		ca := NewModelCache(rv)
+
+		// Get the current record
+		prev, etag, err := c.getRecord(ca, key)
+		if err != nil {
+			return nil, err
+		}
+
+		// Apply the changes to the record's document
+		doc, err := toDocument(prev)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := mergePatch(doc, changes); err != nil {
+			return nil, err
+		}
+
+		// Decode the patched document into the model
+		enc, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		rv.Set(reflect.Zero(rv.Type()))
+		if err := json.Unmarshal(enc, i); err != nil {
+			return nil, err
+		}
+
+		// Rebuild the struct cache from the patched model
+		ca = NewModelCache(rv)
+		ca.SetUpdatedAt()
+
+		res, err := c.updateRecord(ca, i, prev, ifMatch(etag))
+		if err != nil && isPreconditionFailed(err) {
+			continue
+		}
+
+		return res, err
+	}
+
+	return nil, fmt.Errorf("[Error] Patch: %w: key=%s", ErrConflict, key)
+}
+
+// toDocument converts a model into its generic json document form.
+func toDocument(i interface{}) (map[string]interface{}, error) {
+	enc, err := json.Marshal(i)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := map[string]interface{}{}
+	if err := decodeNumbers(enc, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// normalizePatch converts patch values to their generic json form, so they
+// can be compared with and merged into a document.
+func normalizePatch(fields map[string]any) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(fields))
+
+	for k, v := range fields {
+		switch val := v.(type) {
+		case nil:
+			out[k] = nil
+		case PatchOperator:
+			op := PatchOperator{op: val.op}
+			for _, w := range val.values {
+				norm, err := normalizeValue(w)
+				if err != nil {
+					return nil, err
+				}
+				op.values = append(op.values, norm)
+			}
+			out[k] = op
+		case map[string]any:
+			nested, err := normalizePatch(val)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = nested
+		default:
+			norm, err := normalizeValue(v)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = norm
+		}
+	}
+
+	return out, nil
+}
+
+// normalizeValue converts a value to its generic json form.
+func normalizeValue(v interface{}) (interface{}, error) {
+	enc, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var out interface{}
+	if err := decodeNumbers(enc, &out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// decodeNumbers decodes json, keeping numbers as json.Number so integers
+// do not lose precision.
+func decodeNumbers(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// mergePatch applies normalized changes to a document in place.
+func mergePatch(doc map[string]interface{}, changes map[string]interface{}) error {
+	for k, v := range changes {
+		switch val := v.(type) {
+		case nil:
+			delete(doc, k)
+		case PatchOperator:
+			res, err := val.apply(k, doc[k])
+			if err != nil {
+				return err
+			}
+			doc[k] = res
+		case map[string]interface{}:
+			cur, ok := doc[k].(map[string]interface{})
+			if !ok {
+				cur = map[string]interface{}{}
+			}
+			if err := mergePatch(cur, val); err != nil {
+				return err
+			}
+			doc[k] = cur
+		default:
+			doc[k] = val
+		}
+	}
+
+	return nil
+}
+
+// apply returns the result of the operator on a field's current value.
+func (p PatchOperator) apply(field string, cur interface{}) (interface{}, error) {
+	switch p.op {
+	case patchIncrement:
+		return increment(field, cur, p.values[0])
+	case patchAppend:
+		arr, ok := cur.([]interface{})
+		if cur != nil && !ok {
+			return nil, fmt.Errorf("[Error] Patch: field %s is not an array", field)
+		}
+		return append(arr, p.values...), nil
+	case patchRemove:
+		arr, ok := cur.([]interface{})
+		if cur != nil && !ok {
+			return nil, fmt.Errorf("[Error] Patch: field %s is not an array", field)
+		}
+		out := []interface{}{}
+		for _, elem := range arr {
+			keep := true
+			for _, v := range p.values {
+				if reflect.DeepEqual(elem, v) {
+					keep = false
+					break
+				}
+			}
+			if keep {
+				out = append(out, elem)
+			}
+		}
+		return out, nil
+	}
+
+	return nil, fmt.Errorf("[Error] Patch: invalid operator for field %s", field)
+}
+
+// increment adds n to the numeric value cur, keeping integers exact.
+func increment(field string, cur, n interface{}) (interface{}, error) {
+	if cur == nil {
+		cur = json.Number("0")
+	}
+
+	a, ok := cur.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("[Error] Patch: field %s is not a number", field)
+	}
+
+	b, ok := n.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("[Error] Patch: increment for field %s is not a number", field)
+	}
+
+	if x, err := a.Int64(); err == nil {
+		if y, err := b.Int64(); err == nil {
+			return json.Number(fmt.Sprintf("%d", x+y)), nil
+		}
+	}
+
+	x, err := a.Float64()
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := b.Float64()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Number(fmt.Sprintf("%v", x+y)), nil
+}
@@ -2,18 +2,35 @@ package pomdb
 
 import (
 	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
-// Purge permanently removes a soft-deleted record and its indexes from the database.
+// Purge permanently removes a record and its indexes from the database,
+// whether or not it was soft-deleted.
 func (c *Client) Purge(i interface{}) (*string, error) {
+	return c.invokeETag(&Operation{Name: "Purge", Model: i}, func(c *Client, op *Operation) (interface{}, error) {
+		return c.purge(op.Model)
+	})
+}
+
+// purge implements Purge.
+func (c *Client) purge(i interface{}) (*string, error) {
 	// Dereference the input
 	rv, err := dereferenceStruct(i)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := runHook(c.context(), i, beforeDelete); err != nil {
+		return nil, err
+	}
+
 	// Build the struct cache
 	ca := NewModelCache(rv)
 
@@ -23,15 +40,52 @@ func (c *Client) Purge(i interface{}) (*string, error) {
 	// Get the collection
 	co := ca.Collection
 
+	// Set the record's key
+	key := co + "/" + id
+
+	// Prefer the index values of the stored record, and clean up the trash
+	// when the record is soft-deleted or already missing
+	trashed := true
+	prev, _, err := c.getRecord(ca, key)
+	exists := err == nil
+	if exists {
+		ca = NewModelCache(reflect.ValueOf(prev).Elem())
+		if trashed, err = c.isTrashed(ca); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
 	// Check indexes
 	if len(ca.IndexFields) > 0 {
 		if err := c.DeleteIndexItems(ca); err != nil {
 			return nil, err
 		}
+
+		if trashed {
+			if err := c.DeleteTrashItems(ca); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	// Set the record's key
-	key := co + "/" + id
+	// Delete stored versions
+	if err := c.DeleteVersions(ca); err != nil {
+		return nil, err
+	}
+
+	// Remove the trash marker
+	if trashed {
+		mrk := &s3.DeleteObjectInput{
+			Bucket: &c.Bucket,
+			Key:    aws.String(encodeTrashMarker(co, id)),
+		}
+
+		if _, err := c.Service.DeleteObject(c.context(), mrk, c.apiOptions()...); err != nil {
+			return nil, err
+		}
+	}
 
 	// Use s3 to delete the record
 	del := &s3.DeleteObjectInput{
@@ -40,10 +94,85 @@ func (c *Client) Purge(i interface{}) (*string, error) {
 	}
 
 	// Delete the record's data
-	_, err = c.Service.DeleteObject(context.TODO(), del)
+	_, err = c.Service.DeleteObject(c.context(), del, c.apiOptions()...)
 	if err != nil {
 		return nil, err
 	}
 
+	// Records that were already missing were logged when they were purged
+	if exists {
+		if err := c.appendChange(ca, ChangePurge, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := runHook(c.context(), i, afterDelete); err != nil {
+		return nil, err
+	}
+
 	return &id, nil
 }
+
+// PurgeTrashed permanently removes the records of a collection that were
+// soft-deleted more than olderThan ago, and returns the number purged.
+func (c *Client) PurgeTrashed(ctx context.Context, model interface{}, olderThan time.Duration) (int, error) {
+	c = c.WithContext(ctx)
+
+	// Dereference the input
+	rv, err := dereferenceStruct(model)
+	if err != nil {
+		return 0, err
+	}
+
+	// Build the struct cache
+	ca := NewModelCache(rv)
+
+	// Trash markers are written when a record is soft-deleted
+	pfx := ca.Collection + "/trash/"
+	objs, err := c.listObjectsAfter(pfx, "", true)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+
+	purged := 0
+	for _, obj := range objs {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+
+		uid, err := ParseULID(strings.TrimPrefix(*obj.Key, pfx))
+		if err != nil {
+			return purged, err
+		}
+
+		// Load the record, so its hooks see it in full, or purge what is
+		// left of it by ID if it is missing
+		rec, _, err := c.getRecord(ca, ca.Collection+"/"+uid.String())
+		if err != nil && errors.Is(err, ErrNotFound) {
+			rec = reflect.New(rv.Type()).Interface()
+			NewModelCache(reflect.ValueOf(rec).Elem()).ModelID.Set(reflect.ValueOf(uid))
+		} else if err != nil {
+			return purged, err
+		}
+
+		// Prefer the record's deletion time to the marker's write time
+		deleted := aws.ToTime(obj.LastModified)
+		if rc := NewModelCache(reflect.ValueOf(rec).Elem()); rc.IsDeleted() {
+			deleted = time.Time(rc.DeletedAt.Interface().(Timestamp))
+		}
+
+		if deleted.IsZero() || deleted.After(cutoff) {
+			continue
+		}
+
+		if _, err := c.Purge(rec); err != nil {
+			return purged, err
+		}
+
+		purged++
+	}
+
+	return purged, nil
+}
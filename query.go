@@ -13,8 +13,19 @@ type Query struct {
 	Filter    QueryFilter
 	Limit     int
 	NextToken string
+	AsOf      Timestamp
+	Trashed   QueryTrashed
 }
 
+// QueryTrashed selects how a query treats soft-deleted records.
+type QueryTrashed int
+
+const (
+	QueryExcludeTrashed QueryTrashed = iota
+	QueryWithTrashed
+	QueryOnlyTrashed
+)
+
 type QueryFilter int
 
 const (
@@ -28,6 +39,19 @@ const (
 	QueryLimitDefault int = 100
 )
 
+// includes reports whether a record with the given soft-deleted state is
+// part of the query's results.
+func (q *Query) includes(trashed bool) bool {
+	switch q.Trashed {
+	case QueryWithTrashed:
+		return true
+	case QueryOnlyTrashed:
+		return trashed
+	default:
+		return !trashed
+	}
+}
+
 // FilterResults filters the results of a query based on the query filter.
 func (q *Query) Compare(obj types.Object, idx *IndexField) (bool, error) {
 	ifc, err := decodeIndexPrefix(*obj.Key, *idx)
@@ -0,0 +1,592 @@
+package pomdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// RebuildBatchSizeDefault is the number of objects RebuildIndexes processes
+// between checkpoints.
+const RebuildBatchSizeDefault int = 100
+
+// IndexConflict is a unique index value held by more than one record.
+type IndexConflict struct {
+	Field string
+	Value string
+	IDs   []string
+}
+
+// RebuildReport summarizes the changes made by RebuildIndexes.
+type RebuildReport struct {
+	// Records is the number of records scanned.
+	Records int
+
+	// Created is the number of missing index items written.
+	Created int
+
+	// Removed is the number of stale index items deleted.
+	Removed int
+
+	// Conflicts are the unique index values held by more than one live
+	// record. Only the record already holding the value's index item, or
+	// the first one scanned, has an item for it.
+	Conflicts []IndexConflict
+}
+
+// rebuildCheckpoint is the last object a rebuild processed, in the given
+// phase. Phases are "records", "indexes" and "trash".
+type rebuildCheckpoint struct {
+	Fields []string `json:"fields"`
+	Phase  string   `json:"phase"`
+	After  string   `json:"after"`
+}
+
+// encodeRebuildKey returns the key of a collection's rebuild checkpoint.
+func encodeRebuildKey(collection string) string {
+	return "_pomdb/rebuilds/" + collection + ".json"
+}
+
+// indexScan is the state of a single scan of a collection's records and
+// index items. Without repair, problems are only recorded as issues.
+type indexScan struct {
+	ca        *ModelCache
+	fields    map[string]bool
+	repair    bool
+	mu        sync.Mutex
+	records   int
+	items     int
+	created   int
+	removed   int
+	issues    []Issue
+	conflicts map[string]*IndexConflict
+	values    map[string]*sync.Mutex
+}
+
+// newIndexScan returns a scan of the given indexed fields, or of every
+// field if none are given.
+func newIndexScan(ca *ModelCache, fields []string, repair bool) (*indexScan, error) {
+	scan := &indexScan{
+		ca:        ca,
+		repair:    repair,
+		conflicts: make(map[string]*IndexConflict),
+		values:    make(map[string]*sync.Mutex),
+	}
+
+	if len(fields) == 0 {
+		return scan, nil
+	}
+
+	// Check that the fields are indexed
+	scan.fields = make(map[string]bool)
+	for _, field := range fields {
+		if ca.GetIndexField(field) == nil {
+			return nil, fmt.Errorf("[Error] newIndexScan: %w: %s", ErrIndexNotFound, field)
+		}
+
+		scan.fields[field] = true
+	}
+
+	return scan, nil
+}
+
+// selected reports whether the scan covers the given field.
+func (scan *indexScan) selected(field string) bool {
+	return scan.fields == nil || scan.fields[field]
+}
+
+// issue records a problem found by the scan.
+func (scan *indexScan) issue(is Issue) {
+	scan.mu.Lock()
+	defer scan.mu.Unlock()
+
+	scan.issues = append(scan.issues, is)
+}
+
+// count adds to one of the scan's counters.
+func (scan *indexScan) count(n *int) {
+	scan.mu.Lock()
+	defer scan.mu.Unlock()
+
+	*n++
+}
+
+// lockValue locks the unique index value whose items are stored under pfx,
+// and returns the function that unlocks it.
+func (scan *indexScan) lockValue(pfx string) func() {
+	scan.mu.Lock()
+	mu, ok := scan.values[pfx]
+	if !ok {
+		mu = &sync.Mutex{}
+		scan.values[pfx] = mu
+	}
+	scan.mu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+// conflict records the records holding the same unique index value.
+func (scan *indexScan) conflict(index IndexField, owners []string) {
+	scan.mu.Lock()
+	defer scan.mu.Unlock()
+
+	k := index.FieldName + "/" + index.CurrentValue
+	conflict, ok := scan.conflicts[k]
+	if !ok {
+		conflict = &IndexConflict{Field: index.FieldName, Value: index.CurrentValue}
+		scan.conflicts[k] = conflict
+	}
+
+	for _, owner := range owners {
+		found := false
+		for _, id := range conflict.IDs {
+			found = found || id == owner
+		}
+
+		if !found {
+			conflict.IDs = append(conflict.IDs, owner)
+		}
+	}
+}
+
+// sortedConflicts returns the conflicts found by the scan, ordered by field
+// and value.
+func (scan *indexScan) sortedConflicts() []IndexConflict {
+	var conflicts []IndexConflict
+	for _, conflict := range scan.conflicts {
+		sort.Strings(conflict.IDs)
+		conflicts = append(conflicts, *conflict)
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Field != conflicts[j].Field {
+			return conflicts[i].Field < conflicts[j].Field
+		}
+		return conflicts[i].Value < conflicts[j].Value
+	})
+
+	return conflicts
+}
+
+// RebuildIndexes brings the index items of a collection in line with its
+// records. Missing index items are written, and index items that no longer
+// match a record are deleted. Only the given fields are rebuilt, or every
+// indexed field if none are given. Objects are processed in batches, with
+// progress checkpointed after each batch, so an interrupted run resumes
+// where it stopped when called again with the same fields.
+func (c *Client) RebuildIndexes(ctx context.Context, model interface{}, fields ...string) (*RebuildReport, error) {
+	c = c.WithContext(ctx)
+
+	// Dereference the input
+	rv, err := dereferenceStruct(model)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the struct cache
+	ca := NewModelCache(rv)
+
+	scan, err := newIndexScan(ca, fields, true)
+	if err != nil {
+		return nil, fmt.Errorf("[Error] RebuildIndexes: %w", err)
+	}
+
+	selected := append([]string(nil), fields...)
+	sort.Strings(selected)
+
+	// Resume from the checkpoint of an interrupted run of the same fields
+	cp, err := c.getRebuildCheckpoint(ca.Collection)
+	if err != nil {
+		return nil, err
+	}
+
+	if cp == nil || !reflect.DeepEqual(cp.Fields, selected) {
+		cp = &rebuildCheckpoint{Fields: selected, Phase: "records"}
+	}
+
+	save := func(cp *rebuildCheckpoint) error {
+		return c.putRebuildCheckpoint(ca.Collection, cp)
+	}
+
+	if err := c.scanCollection(scan, cp, save); err != nil {
+		return nil, fmt.Errorf("[Error] RebuildIndexes: %w", err)
+	}
+
+	// The rebuild is complete, so the checkpoint is no longer needed
+	del := &s3.DeleteObjectInput{
+		Bucket: &c.Bucket,
+		Key:    aws.String(encodeRebuildKey(ca.Collection)),
+	}
+
+	if _, err := c.Service.DeleteObject(c.context(), del, c.apiOptions()...); err != nil {
+		return nil, err
+	}
+
+	report := &RebuildReport{
+		Records:   scan.records,
+		Created:   scan.created,
+		Removed:   scan.removed,
+		Conflicts: scan.sortedConflicts(),
+	}
+
+	c.logger().Info("rebuilt indexes", "collection", ca.Collection, "records", report.Records, "created", report.Created, "removed", report.Removed, "conflicts", len(report.Conflicts))
+
+	return report, nil
+}
+
+// scanCollection scans the collection's records, then its index and trash
+// items, in batches, starting from the given checkpoint. The checkpoint is
+// passed to save after each batch, unless save is nil.
+func (c *Client) scanCollection(scan *indexScan, cp *rebuildCheckpoint, save func(*rebuildCheckpoint) error) error {
+	phases := []struct {
+		name   string
+		prefix string
+		scan   func(key string) error
+	}{
+		{"records", scan.ca.Collection + "/", func(key string) error { return c.scanRecord(scan, key) }},
+		{"indexes", scan.ca.Collection + "/indexes/", func(key string) error { return c.scanItem(scan, key) }},
+		{"trash", scan.ca.Collection + "/trash/", func(key string) error { return c.scanItem(scan, key) }},
+	}
+
+	started := false
+	for _, ph := range phases {
+		if !started && ph.name != cp.Phase {
+			continue
+		}
+
+		if started {
+			cp.Phase, cp.After = ph.name, ""
+		}
+		started = true
+
+		for {
+			lst := &s3.ListObjectsV2Input{
+				Bucket:  &c.Bucket,
+				Prefix:  aws.String(ph.prefix),
+				MaxKeys: aws.Int32(int32(RebuildBatchSizeDefault)),
+			}
+
+			// Records are listed without nested paths
+			if ph.name == "records" {
+				lst.Delimiter = aws.String("/")
+			}
+
+			if cp.After != "" {
+				lst.StartAfter = aws.String(cp.After)
+			}
+
+			res, err := c.Service.ListObjectsV2(c.context(), lst, c.apiOptions()...)
+			if err != nil {
+				return err
+			}
+
+			if len(res.Contents) == 0 {
+				break
+			}
+
+			err = c.forEach(len(res.Contents), func(i int) error {
+				return ph.scan(*res.Contents[i].Key)
+			})
+			if err != nil {
+				return err
+			}
+
+			cp.After = *res.Contents[len(res.Contents)-1].Key
+			if save != nil {
+				if err := save(cp); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// scanRecord checks that the record stored at key has its index items, and
+// writes the missing ones when repairing. Unique values held by other
+// records are recorded as conflicts instead.
+func (c *Client) scanRecord(scan *indexScan, key string) error {
+	model, _, err := c.getRecord(scan.ca, key)
+	if err != nil && errors.Is(err, ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	mc := NewModelCache(reflect.ValueOf(model).Elem())
+	trashed, err := c.isTrashed(mc)
+	if err != nil {
+		return err
+	}
+
+	// Convert records soft-deleted by earlier versions
+	if !trashed {
+		ts, legacy, err := c.legacyDeletedAt(key)
+		if err != nil {
+			return err
+		}
+
+		if legacy {
+			scan.issue(Issue{Kind: IssueLegacyTrash, Key: key, IDs: []string{mc.GetModelID()}})
+			if scan.repair {
+				if err := c.convertLegacyTrash(mc, model, ts); err != nil {
+					return err
+				}
+			}
+
+			trashed = true
+		}
+	}
+
+	scan.count(&scan.records)
+
+	for _, index := range mc.IndexFields {
+		if !scan.selected(index.FieldName) || index.CurrentValue == "" {
+			continue
+		}
+
+		if err := c.scanRecordIndex(scan, mc, index, trashed); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanRecordIndex checks that a record has the index item of one of its
+// indexed fields, and writes it when repairing.
+func (c *Client) scanRecordIndex(scan *indexScan, mc *ModelCache, index IndexField, trashed bool) error {
+	// Create the pfx path for the index item
+	pfx, err := c.indexPrefix(mc.Collection, index, index.CurrentValue)
+	if err != nil {
+		return err
+	}
+
+	id := mc.GetModelID()
+	item := pfx + "/" + id
+	if trashed {
+		item = encodeTrashKey(item)
+	}
+
+	if index.IndexType == UniqueIndex {
+		// Unique values are only held by live records, as checked by
+		// CheckIndexExists, so the items of trashed records are looked up
+		// in the trash
+		p := pfx + "/"
+		if trashed {
+			p = encodeTrashKey(p)
+		}
+
+		// Records holding the same value are checked one at a time, so
+		// only one of them is given the value's item
+		defer scan.lockValue(p)()
+
+		objs, err := c.listObjects(p)
+		if err != nil {
+			return err
+		}
+
+		exists := false
+		owners := []string{id}
+		for _, obj := range objs {
+			owner := (*obj.Key)[strings.LastIndex(*obj.Key, "/")+1:]
+			if owner == id {
+				exists = exists || *obj.Key == item
+				continue
+			}
+
+			// Trashed records may share values, which are checked when
+			// they are restored
+			if trashed {
+				continue
+			}
+
+			// Stale items are not owners, and are removed with the
+			// collection's index items
+			kind, err := c.checkItem(scan.ca, *obj.Key, index.FieldName, owner)
+			if err != nil {
+				return err
+			}
+
+			if kind == "" {
+				owners = append(owners, owner)
+			}
+		}
+
+		if len(owners) > 1 {
+			c.recordConflict("unique")
+			scan.conflict(index, owners)
+			return nil
+		}
+
+		if exists {
+			return nil
+		}
+	} else {
+		head := &s3.HeadObjectInput{
+			Bucket: &c.Bucket,
+			Key:    &item,
+		}
+
+		var notFound *types.NotFound
+		_, err := c.Service.HeadObject(c.context(), head, c.apiOptions()...)
+		if err == nil {
+			return nil
+		} else if !errors.As(err, &notFound) {
+			return err
+		}
+	}
+
+	scan.issue(Issue{Kind: IssueMissing, Field: index.FieldName, Key: item, IDs: []string{id}})
+	if !scan.repair {
+		return nil
+	}
+
+	c.logDebug("create index item", "collection", mc.Collection, "key", redactKey(item))
+
+	put := &s3.PutObjectInput{
+		Bucket: &c.Bucket,
+		Key:    &item,
+	}
+
+	if _, err := c.Service.PutObject(c.context(), put, c.apiOptions()...); err != nil {
+		return err
+	}
+
+	scan.count(&scan.created)
+
+	return nil
+}
+
+// scanItem checks that the index item stored at key matches its record, and
+// deletes it when repairing if it does not.
+func (c *Client) scanItem(scan *indexScan, key string) error {
+	// Trash markers are not index items
+	ik, err := ParseIndexKey(key)
+	if err != nil || !scan.selected(ik.Field) {
+		return nil
+	}
+
+	scan.count(&scan.items)
+
+	kind, err := c.checkItem(scan.ca, key, ik.Field, ik.ID)
+	if err != nil || kind == "" {
+		return err
+	}
+
+	scan.issue(Issue{Kind: kind, Field: ik.Field, Key: key, IDs: []string{ik.ID}})
+	if !scan.repair {
+		return nil
+	}
+
+	c.logDebug("delete index item", "collection", scan.ca.Collection, "key", redactKey(key))
+
+	del := &s3.DeleteObjectInput{
+		Bucket: &c.Bucket,
+		Key:    &key,
+	}
+
+	if _, err := c.Service.DeleteObject(c.context(), del, c.apiOptions()...); err != nil {
+		return err
+	}
+
+	scan.count(&scan.removed)
+
+	return nil
+}
+
+// checkItem compares the index item stored at key with the record it
+// points to. It returns IssueOrphan if the record does not exist, and
+// IssueMismatch if the record no longer holds the item's value, no longer
+// indexes the field with the item's index type, or is not in the same
+// soft-deleted state as the item.
+func (c *Client) checkItem(ca *ModelCache, key, field, id string) (IssueKind, error) {
+	model, _, err := c.getRecord(ca, ca.Collection+"/"+id)
+	if err != nil && errors.Is(err, ErrNotFound) {
+		return IssueOrphan, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	mc := NewModelCache(reflect.ValueOf(model).Elem())
+	index := mc.GetIndexField(field)
+	if index == nil || index.CurrentValue == "" {
+		return IssueMismatch, nil
+	}
+
+	trashed, err := c.isTrashed(mc)
+	if err != nil {
+		return "", err
+	}
+
+	pfx, err := c.indexPrefix(mc.Collection, *index, index.CurrentValue)
+	if err != nil {
+		return "", err
+	}
+
+	item := pfx + "/" + id
+	if trashed {
+		item = encodeTrashKey(item)
+	}
+
+	if item != key {
+		return IssueMismatch, nil
+	}
+
+	return "", nil
+}
+
+// getRebuildCheckpoint fetches the rebuild checkpoint of a collection, or
+// nil if no rebuild is in progress.
+func (c *Client) getRebuildCheckpoint(collection string) (*rebuildCheckpoint, error) {
+	get := &s3.GetObjectInput{
+		Bucket: &c.Bucket,
+		Key:    aws.String(encodeRebuildKey(collection)),
+	}
+
+	var noSuchKey *types.NoSuchKey
+	obj, err := c.Service.GetObject(c.context(), get, c.apiOptions()...)
+	if err != nil && errors.As(err, &noSuchKey) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+
+	cp := &rebuildCheckpoint{}
+	if err := json.NewDecoder(obj.Body).Decode(cp); err != nil {
+		return nil, err
+	}
+
+	return cp, nil
+}
+
+// putRebuildCheckpoint stores the rebuild checkpoint of a collection.
+func (c *Client) putRebuildCheckpoint(collection string, cp *rebuildCheckpoint) error {
+	enc, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	put := &s3.PutObjectInput{
+		Bucket:      &c.Bucket,
+		Key:         aws.String(encodeRebuildKey(collection)),
+		Body:        bytes.NewReader(enc),
+		ContentType: aws.String("application/json"),
+	}
+
+	_, err = c.Service.PutObject(c.context(), put, c.apiOptions()...)
+	return err
+}
@@ -0,0 +1,115 @@
+package pomdb_test
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/pomdb/pomdb-go"
+)
+
+// member and uniqueMember are the same collection before and after its
+// email field is made unique.
+type member struct {
+	pomdb.Model
+	Email string `json:"email" pomdb:"index,collection=members"`
+}
+
+type uniqueMember struct {
+	pomdb.Model
+	Email string `json:"email" pomdb:"index,unique,collection=members"`
+}
+
+// uniqueItems returns the IDs of the unique index items of an email.
+func uniqueItems(t *testing.T, c *pomdb.Client, email string) []string {
+	t.Helper()
+
+	pfx := "members/indexes/unique/email/" + base64.StdEncoding.EncodeToString([]byte(email)) + "/"
+	res, err := c.Service.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{Bucket: &c.Bucket, Prefix: &pfx})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, obj := range res.Contents {
+		ids = append(ids, (*obj.Key)[len(pfx):])
+	}
+
+	return ids
+}
+
+func TestRebuildIndexesConflicts(t *testing.T) {
+	c := newTestClient(t)
+
+	// Records sharing a value before it is made unique, scanned in the
+	// same batch
+	for i := 0; i < 16; i++ {
+		if _, err := c.Create(&member{Email: "a@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Widen the window between checking a value's items and writing one
+	c.Service = s3.New(c.Service.Options(), s3.WithAPIOptions(func(st *middleware.Stack) error {
+		return st.Initialize.Add(middleware.InitializeMiddlewareFunc("delay", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			out, md, err := next.HandleInitialize(ctx, in)
+			if lst, ok := in.Parameters.(*s3.ListObjectsV2Input); ok && strings.Contains(*lst.Prefix, "/indexes/") {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			return out, md, err
+		}), middleware.After)
+	}))
+
+	report, err := c.RebuildIndexes(context.Background(), &uniqueMember{}, "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Conflicts) != 1 || len(report.Conflicts[0].IDs) != 16 {
+		t.Fatalf("conflicts = %+v, want a@example.com held by every record", report.Conflicts)
+	}
+
+	// Only one of the records is given the value's item
+	if ids := uniqueItems(t, c, "a@example.com"); len(ids) != 1 {
+		t.Errorf("unique items = %v, want one", ids)
+	}
+}
+
+func TestRebuildIndexesStaleOwner(t *testing.T) {
+	c := newTestClient(t)
+
+	m := &uniqueMember{Email: "a@example.com"}
+	if _, err := c.Create(m); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the record's item with one of a record that does not exist
+	pfx := "members/indexes/unique/email/" + base64.StdEncoding.EncodeToString([]byte(m.Email)) + "/"
+	if _, err := c.Service.DeleteObject(context.Background(), &s3.DeleteObjectInput{Bucket: &c.Bucket, Key: aws.String(pfx + m.ID.String())}); err != nil {
+		t.Fatal(err)
+	}
+
+	orphan := pomdb.NewULID().String()
+	if _, err := c.Service.PutObject(context.Background(), &s3.PutObjectInput{Bucket: &c.Bucket, Key: aws.String(pfx + orphan)}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := c.RebuildIndexes(context.Background(), &uniqueMember{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Conflicts) != 0 || report.Created != 1 || report.Removed != 1 {
+		t.Errorf("report = %+v, want the item rewritten and the orphan removed", report)
+	}
+
+	if ids := uniqueItems(t, c, m.Email); len(ids) != 1 || ids[0] != m.ID.String() {
+		t.Errorf("unique items = %v, want %s", ids, m.ID)
+	}
+}
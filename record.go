@@ -0,0 +1,260 @@
+package pomdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// getRecord fetches the record stored at key and decodes it into a new
+// instance of the cached model type. The record's ETag is returned with it.
+func (c *Client) getRecord(ca *ModelCache, key string) (interface{}, *string, error) {
+	get := &s3.GetObjectInput{
+		Bucket: &c.Bucket,
+		Key:    &key,
+	}
+
+	// Get the record's data
+	var noSuchKey *types.NoSuchKey
+	doc, err := c.Service.GetObject(c.context(), get, c.apiOptions()...)
+	if err != nil && errors.As(err, &noSuchKey) {
+		return nil, nil, fmt.Errorf("[Error] getRecord: %w: key=%s: %w", ErrNotFound, key, err)
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	model, err := c.decodeRecord(ca, key, doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return model, doc.ETag, nil
+}
+
+// decodeRecord reads a record fetched from key and decodes it into a new
+// instance of the cached model type.
+func (c *Client) decodeRecord(ca *ModelCache, key string, doc *s3.GetObjectOutput) (interface{}, error) {
+	codec, body, err := c.readRecord(ca, key, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the record
+	elem := reflect.TypeOf(ca.Reference).Elem()
+	model := reflect.New(elem).Interface()
+	if err := codec.Unmarshal(body, model); err != nil {
+		return nil, err
+	}
+
+	return model, nil
+}
+
+// readRecord reads the body of a record fetched from key, decrypting and
+// decompressing it as needed, and returns it along with the codec it was
+// written with.
+func (c *Client) readRecord(ca *ModelCache, key string, doc *s3.GetObjectOutput) (Codec, []byte, error) {
+	defer doc.Body.Close()
+
+	// Read the record's body
+	body, err := io.ReadAll(doc.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Encrypted records are bound to the record they were written for
+	ad := recordAD(ca.Collection, recordKeyID(ca.Collection, key, doc.Metadata))
+
+	// Decrypt the record
+	if body, err = c.decryptRecordBody(body, ad, doc.Metadata); err != nil {
+		return nil, nil, err
+	}
+
+	// Decompress the record
+	if body, err = decompress(recordCompression(doc), body); err != nil {
+		return nil, nil, err
+	}
+
+	// Get the record's codec
+	ct := doc.Metadata[metaContentType]
+	if ct == "" {
+		ct = aws.ToString(doc.ContentType)
+	}
+	codec := c.codecFor(ca.Collection, ct)
+
+	// Decrypt the record's fields
+	if body, err = c.decryptRecordFields(codec, body, ad, doc.Metadata); err != nil {
+		return nil, nil, err
+	}
+
+	return codec, body, nil
+}
+
+// recordKeyID returns the ID of the record stored at key, which is either
+// the record itself, one of its versions, or a changelog entry holding it.
+func recordKeyID(collection, key string, meta map[string]string) string {
+	rest := strings.TrimPrefix(key, collection+"/")
+
+	switch {
+	case strings.HasPrefix(rest, "versions/"):
+		rest = strings.TrimPrefix(rest, "versions/")
+		if i := strings.Index(rest, "/"); i >= 0 {
+			return rest[:i]
+		}
+	case strings.HasPrefix(key, encodeChangePrefix(collection)):
+		return meta[metaChangeRecord]
+	}
+
+	return rest[strings.LastIndex(rest, "/")+1:]
+}
+
+// encodedRecord is a record encoded for storage, along with the metadata
+// and headers describing its body.
+type encodedRecord struct {
+	body            []byte
+	meta            map[string]string
+	contentType     *string
+	contentEncoding *string
+}
+
+// encodeRecord encodes, compresses and encrypts the model as configured for
+// the cached collection.
+func (c *Client) encodeRecord(ca *ModelCache, i interface{}) (*encodedRecord, error) {
+	// Encode the object
+	codec := c.codec(ca.Collection)
+	enc, err := codec.Marshal(i)
+	if err != nil {
+		return nil, err
+	}
+
+	// Encrypt the object's fields
+	enc, meta, err := c.encryptRecordFields(ca, codec, enc)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta == nil {
+		meta = map[string]string{}
+	}
+	meta[metaContentType] = codec.ContentType()
+
+	// Compress the object
+	comp := c.options(ca.Collection).Compression
+	if comp != CompressionNone {
+		if enc, err = compress(comp, enc); err != nil {
+			return nil, err
+		}
+
+		meta[metaCompression] = string(comp)
+	}
+
+	// Encrypt the object
+	enc, meta, err = c.encryptRecordBody(ca, enc, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	er := &encodedRecord{body: enc, meta: meta}
+
+	// The content type and encoding only describe bodies that are not
+	// encrypted
+	if !isEncrypted(meta) || meta[metaFields] != "" {
+		er.contentType = aws.String(codec.ContentType())
+		if comp != CompressionNone {
+			er.contentEncoding = aws.String(string(comp))
+		}
+	}
+
+	return er, nil
+}
+
+// putRecord encodes the model and stores it as the cached record. When the
+// collection keeps history, the new version is stored alongside it.
+func (c *Client) putRecord(ca *ModelCache, i interface{}, optFns ...func(*s3.Options)) (*string, error) {
+	// Set the record's key
+	key := ca.Collection + "/" + ca.GetModelID()
+
+	er, err := c.encodeRecord(ca, i)
+	if err != nil {
+		return nil, err
+	}
+
+	put := &s3.PutObjectInput{
+		Bucket:          &c.Bucket,
+		Key:             &key,
+		Body:            bytes.NewReader(er.body),
+		Metadata:        er.meta,
+		ContentType:     er.contentType,
+		ContentEncoding: er.contentEncoding,
+	}
+
+	// Tag records that expire, for lifecycle rules
+	if c.options(ca.Collection).TTL > 0 {
+		put.Tagging = aws.String(ttlTag + "=true")
+	}
+
+	// Set the record's data
+	res, err := c.Service.PutObject(c.context(), put, c.apiOptions(optFns...)...)
+	if err != nil && isPreconditionFailed(err) {
+		return nil, fmt.Errorf("[Error] putRecord: %w: key=%s: %w", ErrConflict, key, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if c.options(ca.Collection).History {
+		ver := &s3.PutObjectInput{
+			Bucket:          &c.Bucket,
+			Key:             aws.String(encodeVersionKey(ca.Collection, ca.GetModelID(), time.Now())),
+			Body:            bytes.NewReader(er.body),
+			Metadata:        er.meta,
+			ContentType:     er.contentType,
+			ContentEncoding: er.contentEncoding,
+		}
+
+		if _, err := c.Service.PutObject(c.context(), ver, c.apiOptions()...); err != nil {
+			return nil, err
+		}
+	}
+
+	return res.ETag, nil
+}
+
+// ifMatch makes a write conditional on the object's current ETag.
+func ifMatch(etag *string) func(*s3.Options) {
+	return s3.WithAPIOptions(smithyhttp.AddHeaderValue("If-Match", *etag))
+}
+
+// ifNoneMatch makes a write conditional on the object not existing.
+func ifNoneMatch() func(*s3.Options) {
+	return s3.WithAPIOptions(smithyhttp.AddHeaderValue("If-None-Match", "*"))
+}
+
+// withMetadata adds user-defined metadata to a write. Keys of the metadata
+// PomDB stores with records are ignored.
+func withMetadata(meta map[string]string) func(*s3.Options) {
+	return func(o *s3.Options) {
+		for k, v := range meta {
+			if strings.HasPrefix(strings.ToLower(k), "pomdb-") {
+				continue
+			}
+
+			o.APIOptions = append(o.APIOptions, smithyhttp.AddHeaderValue("X-Amz-Meta-"+k, v))
+		}
+	}
+}
+
+// isPreconditionFailed reports whether a conditional write was rejected.
+func isPreconditionFailed(err error) bool {
+	var re *awshttp.ResponseError
+	return errors.As(err, &re) && re.HTTPStatusCode() == http.StatusPreconditionFailed
+}
@@ -1,13 +1,23 @@
 package pomdb
 
 import (
-	"context"
+	"reflect"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 // Restore restores soft-deleted records and indexes in the database.
+// Records that are not soft-deleted are left unchanged.
 func (c *Client) Restore(i interface{}) (*string, error) {
+	return c.invokeETag(&Operation{Name: "Restore", Model: i}, func(c *Client, op *Operation) (interface{}, error) {
+		return c.restore(op.Model)
+	})
+}
+
+// restore implements Restore.
+func (c *Client) restore(i interface{}) (*string, error) {
 	// Dereference the input
 	rv, err := dereferenceStruct(i)
 	if err != nil {
@@ -23,18 +33,76 @@ func (c *Client) Restore(i interface{}) (*string, error) {
 	// Get the collection
 	co := ca.Collection
 
-	key := co + "/" + id
+	// Get the stored record
+	prev, _, err := c.getRecord(ca, co+"/"+id)
+	if err != nil {
+		return nil, err
+	}
+
+	pc := NewModelCache(reflect.ValueOf(prev).Elem())
+
+	// Live records have nothing to restore
+	trashed, err := c.isTrashed(pc)
+	if err != nil {
+		return nil, err
+	}
+
+	if !trashed && !pc.IsDeleted() {
+		return &id, nil
+	}
+
+	// Restore indexes, unless their values were taken in the meantime
+	if len(pc.IndexFields) > 0 {
+		if err := c.CheckIndexExists(pc); err != nil {
+			return nil, err
+		}
+
+		if err := c.RestoreIndexItems(pc); err != nil {
+			return nil, err
+		}
+	}
 
-	// Restore the record
-	del := &s3.DeleteObjectTaggingInput{
+	// Clear the record's deletion time
+	if pc.IsDeleted() {
+		pc.ClearDeletedAt()
+		if _, err := c.putRecord(pc, prev); err != nil {
+			return nil, err
+		}
+	}
+
+	// Remove the trash marker
+	del := &s3.DeleteObjectInput{
 		Bucket: &c.Bucket,
-		Key:    &key,
+		Key:    aws.String(encodeTrashMarker(co, id)),
 	}
 
-	_, err = c.Service.DeleteObjectTagging(context.TODO(), del)
-	if err != nil {
+	if _, err := c.Service.DeleteObject(c.context(), del, c.apiOptions()...); err != nil {
+		return nil, err
+	}
+
+	if err := c.appendChange(pc, ChangeRestore, prev); err != nil {
 		return nil, err
 	}
 
+	// Reflect the restore in the model
+	ca.ClearDeletedAt()
+
 	return &id, nil
 }
+
+// listTrashed returns the IDs of the soft-deleted records in a collection.
+func (c *Client) listTrashed(collection string) (map[string]bool, error) {
+	pfx := collection + "/trash/"
+
+	objs, err := c.listObjectsAfter(pfx, "", true)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool)
+	for _, obj := range objs {
+		ids[strings.TrimPrefix(*obj.Key, pfx)] = true
+	}
+
+	return ids, nil
+}
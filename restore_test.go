@@ -0,0 +1,42 @@
+package pomdb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pomdb/pomdb-go"
+)
+
+func TestRestoreLiveRecord(t *testing.T) {
+	c := newTestClient(t)
+	c.SoftDeletes = true
+
+	if err := c.Register(&account{}, pomdb.CollectionOptions{Changelog: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &account{Email: "a@example.com"}
+	if _, err := c.Create(a); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Restore(&account{Model: pomdb.Model{ID: a.ID}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the creation is logged
+	res, err := c.Service.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{Bucket: &c.Bucket, Prefix: aws.String("accounts/_changes/")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Contents) != 1 {
+		t.Errorf("changelog has %d entries, want 1", len(res.Contents))
+	}
+
+	if _, err := c.FindOne(pomdb.Query{Model: &account{}, Field: "email", Value: a.Email}); err != nil {
+		t.Errorf("FindOne after restoring a live record: %v", err)
+	}
+}
@@ -0,0 +1,504 @@
+package pomdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// SnapshotLocation is where a snapshot is stored. Bucket defaults to the
+// client's bucket, and Prefix to _pomdb/snapshots/{id}.
+type SnapshotLocation struct {
+	Bucket string `json:"bucket"`
+	Prefix string `json:"prefix"`
+}
+
+// SnapshotManifest describes a snapshot. It is stored alongside the
+// snapshot's objects, under {prefix}/_pomdb/snapshot.json.
+type SnapshotManifest struct {
+	ID string `json:"id"`
+
+	// Bucket is the bucket the snapshot was taken of.
+	Bucket string `json:"bucket"`
+
+	// Location is where the snapshot is stored.
+	Location SnapshotLocation `json:"location"`
+
+	// Collections are the manifests of the collections in the snapshot.
+	Collections []CollectionManifest `json:"collections"`
+
+	// Objects and Size are the number and total size of the objects copied.
+	Objects int   `json:"objects"`
+	Size    int64 `json:"size"`
+
+	// Changed is the number of objects modified or deleted while the
+	// snapshot was taken. Modified objects are copied as they were when
+	// copied, so the snapshot is only consistent if Changed is zero.
+	Changed int `json:"changed"`
+
+	StartedAt   Timestamp `json:"started_at"`
+	CompletedAt Timestamp `json:"completed_at"`
+}
+
+// snapshotPrefixDefault is the prefix snapshots are stored under by default.
+const snapshotPrefixDefault = "_pomdb/snapshots/"
+
+// snapshotObject is an object copied by a snapshot or a restore.
+type snapshotObject struct {
+	key  string
+	etag *string
+	size int64
+}
+
+// Snapshot copies the records, index items, manifests and migration state
+// of every registered collection into a snapshot at dest. Objects are
+// copied server-side where the service supports it. The snapshot is taken
+// object by object, so writes made while it is taken are counted in the
+// manifest's Changed, and should be paused for a consistent snapshot.
+func (c *Client) Snapshot(ctx context.Context, dest SnapshotLocation) (*SnapshotManifest, error) {
+	c = c.WithContext(ctx)
+
+	id := NewULID().String()
+	if dest.Bucket == "" {
+		dest.Bucket = c.Bucket
+	}
+	if dest.Prefix == "" {
+		dest.Prefix = snapshotPrefixDefault + id
+	}
+	dest.Prefix = strings.TrimSuffix(dest.Prefix, "/")
+
+	collections, err := c.Collections(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sm := &SnapshotManifest{
+		ID:          id,
+		Bucket:      c.Bucket,
+		Location:    dest,
+		Collections: collections,
+		StartedAt:   NewTimestamp(),
+	}
+
+	var mu sync.Mutex
+	for _, col := range collections {
+		objs, err := c.snapshotObjects(c.Bucket, "", col.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		err = c.forEach(len(objs), func(i int) error {
+			obj := objs[i]
+			changed, err := c.copyObject(c.Bucket, obj.key, dest.Bucket, dest.Prefix+"/"+obj.key, obj.etag)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			sm.Objects++
+			sm.Size += obj.size
+			if changed {
+				sm.Changed++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("[Error] Snapshot: %w", err)
+		}
+	}
+
+	sm.CompletedAt = NewTimestamp()
+
+	enc, err := json.Marshal(sm)
+	if err != nil {
+		return nil, err
+	}
+
+	put := &s3.PutObjectInput{
+		Bucket:      aws.String(dest.Bucket),
+		Key:         aws.String(dest.Prefix + "/_pomdb/snapshot.json"),
+		Body:        bytes.NewReader(enc),
+		ContentType: aws.String("application/json"),
+	}
+
+	if _, err := c.Service.PutObject(c.context(), put, c.apiOptions()...); err != nil {
+		return nil, fmt.Errorf("[Error] Snapshot: %w", err)
+	}
+
+	c.logger().Info("took snapshot", "snapshot", id, "bucket", dest.Bucket, "prefix", dest.Prefix, "objects", sm.Objects, "changed", sm.Changed)
+
+	return sm, nil
+}
+
+// Snapshots returns the manifests of the snapshots stored at the default
+// location, in the order they were taken.
+func (c *Client) Snapshots(ctx context.Context) ([]SnapshotManifest, error) {
+	c = c.WithContext(ctx)
+
+	lst := &s3.ListObjectsV2Input{
+		Bucket:    &c.Bucket,
+		Prefix:    aws.String(snapshotPrefixDefault),
+		Delimiter: aws.String("/"),
+	}
+
+	var snapshots []SnapshotManifest
+	pgr := s3.NewListObjectsV2Paginator(c.Service, lst)
+	for pgr.HasMorePages() {
+		pge, err := pgr.NextPage(c.context(), c.apiOptions()...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cp := range pge.CommonPrefixes {
+			loc := SnapshotLocation{Bucket: c.Bucket, Prefix: strings.TrimSuffix(*cp.Prefix, "/")}
+
+			sm, err := c.getSnapshotManifest(loc)
+			if err != nil && errors.Is(err, ErrNotFound) {
+				// Snapshots without a manifest did not complete
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			snapshots = append(snapshots, *sm)
+		}
+	}
+
+	return snapshots, nil
+}
+
+// RestoreSnapshot rolls the collections of a snapshot back to the state
+// they were in when it was taken. Objects are copied back from the
+// snapshot, unless they are unchanged, and objects of the collections that
+// are not in the snapshot are deleted. Collections that are not in the
+// snapshot are left as they are. Changelogs are not rolled back: the
+// records the restore changes are logged as created, updated or purged, in
+// collections that keep a changelog before or after the restore. Likewise,
+// the versions of restored records are kept, and the restored records are
+// stored as new versions. The restore is not atomic, so writes to the
+// collections should be paused while it runs.
+func (c *Client) RestoreSnapshot(ctx context.Context, src SnapshotLocation) (*SnapshotManifest, error) {
+	c = c.WithContext(ctx)
+
+	if src.Bucket == "" {
+		src.Bucket = c.Bucket
+	}
+	src.Prefix = strings.TrimSuffix(src.Prefix, "/")
+
+	sm, err := c.getSnapshotManifest(src)
+	if err != nil {
+		return nil, err
+	}
+
+	restored, deleted := 0, 0
+	var mu sync.Mutex
+	for _, col := range sm.Collections {
+		// Changes are logged if the collection keeps a changelog before or
+		// after the restore
+		logged, history := col.Changelog, col.History
+		if m, err := c.getManifest(col.Name); err != nil {
+			return nil, err
+		} else if m != nil {
+			logged, history = logged || m.Changelog, history || m.History
+		}
+
+		// Copy back the objects that differ from the snapshot
+		snap, err := c.snapshotObjects(src.Bucket, src.Prefix+"/", col.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		live, err := c.snapshotObjects(c.Bucket, "", col.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		current := make(map[string]string, len(live))
+		for _, obj := range live {
+			current[obj.key] = aws.ToString(obj.etag)
+		}
+
+		kept := make(map[string]bool, len(snap))
+		for _, obj := range snap {
+			kept[obj.key] = true
+		}
+
+		err = c.forEach(len(snap), func(i int) error {
+			obj := snap[i]
+			if etag, ok := current[obj.key]; ok && etag == aws.ToString(obj.etag) {
+				return nil
+			}
+
+			if _, err := c.copyObject(src.Bucket, src.Prefix+"/"+obj.key, c.Bucket, obj.key, nil); err != nil {
+				return err
+			}
+
+			if id, ok := snapshotRecordID(col.Name, obj.key); ok {
+				if history {
+					if err := c.copyVersion(obj.key, encodeVersionKey(col.Name, id, time.Now())); err != nil {
+						return err
+					}
+				}
+
+				op := ChangeUpdate
+				if _, ok := current[obj.key]; !ok {
+					op = ChangeCreate
+				}
+
+				if logged {
+					if err := c.appendStoredChange(col.Name, id, op); err != nil {
+						return err
+					}
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			restored++
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("[Error] RestoreSnapshot: %w", err)
+		}
+
+		// Delete the objects written since the snapshot was taken, except
+		// the versions of the records that are kept
+		err = c.forEach(len(live), func(i int) error {
+			if kept[live[i].key] {
+				return nil
+			}
+
+			if id, ok := snapshotVersionID(col.Name, live[i].key); ok && kept[col.Name+"/"+id] {
+				return nil
+			}
+
+			del := &s3.DeleteObjectInput{
+				Bucket: &c.Bucket,
+				Key:    aws.String(live[i].key),
+			}
+
+			if _, err := c.Service.DeleteObject(c.context(), del, c.apiOptions()...); err != nil {
+				return err
+			}
+
+			if id, ok := snapshotRecordID(col.Name, live[i].key); ok && logged {
+				if err := c.appendStoredChange(col.Name, id, ChangePurge); err != nil {
+					return err
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			deleted++
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("[Error] RestoreSnapshot: %w", err)
+		}
+	}
+
+	c.logger().Info("restored snapshot", "snapshot", sm.ID, "restored", restored, "deleted", deleted)
+
+	return sm, nil
+}
+
+// snapshotObjects lists the objects of a collection, relative to the given
+// prefix: its records, index items and versions, and its manifest and
+// migration state. Its changelog is not listed, as it records the changes
+// made to the collection rather than its state.
+func (c *Client) snapshotObjects(bucket, prefix, collection string) ([]snapshotObject, error) {
+	var objs []snapshotObject
+	for _, pfx := range []string{collection + "/", encodeManifestKey(collection), encodeMigrationKey(collection)} {
+		lst := &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix + pfx),
+		}
+
+		pgr := s3.NewListObjectsV2Paginator(c.Service, lst)
+		for pgr.HasMorePages() {
+			pge, err := pgr.NextPage(c.context(), c.apiOptions()...)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, obj := range pge.Contents {
+				key := strings.TrimPrefix(*obj.Key, prefix)
+
+				// Only the manifest and migration state keys themselves
+				if !strings.HasSuffix(pfx, "/") && key != pfx {
+					continue
+				}
+
+				if strings.HasPrefix(key, encodeChangePrefix(collection)) {
+					continue
+				}
+
+				objs = append(objs, snapshotObject{key: key, etag: obj.ETag, size: aws.ToInt64(obj.Size)})
+			}
+		}
+	}
+
+	return objs, nil
+}
+
+// snapshotRecordID returns the ID of the record stored at key, if key is
+// the key of a record of the collection.
+func snapshotRecordID(collection, key string) (string, bool) {
+	id, ok := strings.CutPrefix(key, collection+"/")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+
+	return id, true
+}
+
+// snapshotVersionID returns the ID of the record a version stored at key
+// belongs to, if key is the key of a version of the collection.
+func snapshotVersionID(collection, key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, collection+"/versions/")
+	if !ok {
+		return "", false
+	}
+
+	id, _, ok := strings.Cut(rest, "/")
+	return id, ok
+}
+
+// copyObject copies an object, server-side where the service supports it.
+// With an ETag, the copy is of that version of the object; if the object
+// changed or was deleted since, its current version is copied, or nothing,
+// and copyObject reports the change.
+func (c *Client) copyObject(srcBucket, srcKey, dstBucket, dstKey string, etag *string) (bool, error) {
+	cpy := &s3.CopyObjectInput{
+		Bucket:            aws.String(dstBucket),
+		Key:               aws.String(dstKey),
+		CopySource:        aws.String(encodeCopySource(srcBucket, srcKey)),
+		CopySourceIfMatch: etag,
+	}
+
+	_, err := c.Service.CopyObject(c.context(), cpy, c.apiOptions()...)
+	switch {
+	case err == nil:
+		return false, nil
+	case isPreconditionFailed(err):
+		_, err := c.copyObject(srcBucket, srcKey, dstBucket, dstKey, nil)
+		if err != nil && apiErrorCode(err) == "NoSuchKey" {
+			return true, nil
+		}
+		return true, err
+	case apiErrorCode(err) == "NoSuchKey":
+		return etag != nil, nil
+	case apiErrorCode(err) != "NotImplemented":
+		return false, err
+	}
+
+	// Copy the object through the client
+	get := &s3.GetObjectInput{
+		Bucket:  aws.String(srcBucket),
+		Key:     aws.String(srcKey),
+		IfMatch: etag,
+	}
+
+	var noSuchKey *types.NoSuchKey
+	obj, err := c.Service.GetObject(c.context(), get, c.apiOptions()...)
+	if err != nil && (errors.As(err, &noSuchKey) || isPreconditionFailed(err)) {
+		if etag == nil {
+			return false, nil
+		}
+		_, err := c.copyObject(srcBucket, srcKey, dstBucket, dstKey, nil)
+		return true, err
+	} else if err != nil {
+		return false, err
+	}
+	defer obj.Body.Close()
+
+	put := &s3.PutObjectInput{
+		Bucket:          aws.String(dstBucket),
+		Key:             aws.String(dstKey),
+		Body:            obj.Body,
+		ContentLength:   obj.ContentLength,
+		ContentType:     obj.ContentType,
+		ContentEncoding: obj.ContentEncoding,
+		Metadata:        obj.Metadata,
+	}
+
+	_, err = c.Service.PutObject(c.context(), put, c.apiOptions()...)
+	return false, err
+}
+
+// copyVersion stores the record at key as a version. The record's tags are
+// not copied, so lifecycle rules scoped to records do not expire it.
+func (c *Client) copyVersion(key, versionKey string) error {
+	cpy := &s3.CopyObjectInput{
+		Bucket:           &c.Bucket,
+		Key:              aws.String(versionKey),
+		CopySource:       aws.String(encodeCopySource(c.Bucket, key)),
+		TaggingDirective: types.TaggingDirectiveReplace,
+	}
+
+	_, err := c.Service.CopyObject(c.context(), cpy, c.apiOptions()...)
+	if err != nil && apiErrorCode(err) == "NotImplemented" {
+		_, err = c.copyObject(c.Bucket, key, c.Bucket, versionKey, nil)
+	}
+
+	return err
+}
+
+// getSnapshotManifest fetches the manifest of the snapshot at loc.
+func (c *Client) getSnapshotManifest(loc SnapshotLocation) (*SnapshotManifest, error) {
+	get := &s3.GetObjectInput{
+		Bucket: aws.String(loc.Bucket),
+		Key:    aws.String(loc.Prefix + "/_pomdb/snapshot.json"),
+	}
+
+	var noSuchKey *types.NoSuchKey
+	obj, err := c.Service.GetObject(c.context(), get, c.apiOptions()...)
+	if err != nil && errors.As(err, &noSuchKey) {
+		return nil, fmt.Errorf("[Error] getSnapshotManifest: %w: no snapshot at %s/%s", ErrNotFound, loc.Bucket, loc.Prefix)
+	} else if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+
+	sm := &SnapshotManifest{}
+	if err := json.NewDecoder(obj.Body).Decode(sm); err != nil {
+		return nil, fmt.Errorf("[Error] getSnapshotManifest: %w", err)
+	}
+
+	return sm, nil
+}
+
+// encodeCopySource returns the URL-encoded copy source of an object.
+func encodeCopySource(bucket, key string) string {
+	segs := strings.Split(key, "/")
+	for i, seg := range segs {
+		segs[i] = strings.ReplaceAll(url.QueryEscape(seg), "+", "%20")
+	}
+
+	return bucket + "/" + strings.Join(segs, "/")
+}
+
+// apiErrorCode returns the error code of an S3 error, if any.
+func apiErrorCode(err error) string {
+	var ae smithy.APIError
+	if errors.As(err, &ae) {
+		return ae.ErrorCode()
+	}
+
+	return ""
+}
@@ -0,0 +1,276 @@
+package pomdb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer and meter used by the client.
+const instrumentationName = "github.com/pomdb/pomdb-go"
+
+// telemetry holds the tracer and metric instruments of a client.
+type telemetry struct {
+	tracer trace.Tracer
+
+	operationDuration metric.Float64Histogram
+	requests          metric.Int64Counter
+	requestDuration   metric.Float64Histogram
+	bytes             metric.Int64Counter
+	retries           metric.Int64Counter
+	conflicts         metric.Int64Counter
+}
+
+// telemetryState holds the telemetry of a client, which is shared with the
+// copies made by WithContext and created on first use.
+type telemetryState struct {
+	once sync.Once
+	t    *telemetry
+}
+
+// telemetryMu guards the allocation of clients' telemetry state.
+var telemetryMu sync.Mutex
+
+// telemetryState returns the client's telemetry state, allocating it if
+// needed.
+func (c *Client) telemetryState() *telemetryState {
+	telemetryMu.Lock()
+	defer telemetryMu.Unlock()
+
+	if c.tel == nil {
+		c.tel = &telemetryState{}
+	}
+
+	return c.tel
+}
+
+// telemetry returns the client's tracer and metric instruments, or nil if
+// neither a TracerProvider nor a MeterProvider is set. They are created
+// from the providers set when the client is first used.
+func (c *Client) telemetry() *telemetry {
+	if c.TracerProvider == nil && c.MeterProvider == nil {
+		return nil
+	}
+
+	st := c.telemetryState()
+	st.once.Do(func() {
+		st.t = newTelemetry(c.TracerProvider, c.MeterProvider)
+	})
+
+	return st.t
+}
+
+// newTelemetry creates a tracer and metric instruments from the given
+// providers, either of which may be nil.
+func newTelemetry(tp trace.TracerProvider, mp metric.MeterProvider) *telemetry {
+	t := &telemetry{}
+
+	if tp != nil {
+		t.tracer = tp.Tracer(instrumentationName)
+	}
+
+	if mp == nil {
+		return t
+	}
+
+	m := mp.Meter(instrumentationName)
+
+	// Instruments are nil if they cannot be created
+	t.operationDuration, _ = m.Float64Histogram("pomdb.operation.duration",
+		metric.WithDescription("Duration of client operations."),
+		metric.WithUnit("s"))
+	t.requests, _ = m.Int64Counter("pomdb.s3.requests",
+		metric.WithDescription("Number of S3 requests, including retries."),
+		metric.WithUnit("{request}"))
+	t.requestDuration, _ = m.Float64Histogram("pomdb.s3.request.duration",
+		metric.WithDescription("Duration of S3 calls, including retries."),
+		metric.WithUnit("s"))
+	t.bytes, _ = m.Int64Counter("pomdb.s3.bytes",
+		metric.WithDescription("Number of bytes sent to and received from S3."),
+		metric.WithUnit("By"))
+	t.retries, _ = m.Int64Counter("pomdb.s3.retries",
+		metric.WithDescription("Number of retried S3 requests."),
+		metric.WithUnit("{request}"))
+	t.conflicts, _ = m.Int64Counter("pomdb.conflicts",
+		metric.WithDescription("Number of failed conditional writes and unique index conflicts."),
+		metric.WithUnit("{conflict}"))
+
+	return t
+}
+
+// operationAttributes returns the attributes of the operation in ctx.
+func operationAttributes(ctx context.Context) []attribute.KeyValue {
+	op, ok := ctx.Value(operationKey{}).(*Operation)
+	if !ok {
+		return nil
+	}
+
+	return []attribute.KeyValue{
+		attribute.String("pomdb.operation", op.Name),
+		attribute.String("pomdb.collection", op.Collection),
+	}
+}
+
+// withAttributes returns a copy of attrs with kv appended.
+func withAttributes(attrs []attribute.KeyValue, kv ...attribute.KeyValue) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, 0, len(attrs)+len(kv))
+	out = append(out, attrs...)
+	return append(out, kv...)
+}
+
+// startOperation starts the span of an operation, and returns a function
+// that ends it and records its duration.
+func (c *Client) startOperation(op *Operation) func(err error) {
+	t := c.telemetry()
+	if t == nil {
+		return func(error) {}
+	}
+
+	start := time.Now()
+	attrs := []attribute.KeyValue{
+		attribute.String("pomdb.operation", op.Name),
+		attribute.String("pomdb.collection", op.Collection),
+	}
+
+	var span trace.Span
+	if t.tracer != nil {
+		op.Context, span = t.tracer.Start(op.Context, "pomdb."+op.Name,
+			trace.WithSpanKind(trace.SpanKindInternal),
+			trace.WithAttributes(attrs...))
+	}
+
+	return func(err error) {
+		if t.operationDuration != nil {
+			t.operationDuration.Record(op.Context, time.Since(start).Seconds(),
+				metric.WithAttributes(withAttributes(attrs, attribute.Bool("pomdb.error", err != nil))...))
+		}
+
+		if span != nil {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+	}
+}
+
+// recordConflict counts a conflict of the given kind, either "precondition"
+// or "unique".
+func (c *Client) recordConflict(kind string) {
+	t := c.telemetry()
+	if t == nil || t.conflicts == nil {
+		return
+	}
+
+	ctx := c.context()
+	attrs := withAttributes(operationAttributes(ctx), attribute.String("pomdb.conflict", kind))
+	t.conflicts.Add(ctx, 1, metric.WithAttributes(attrs...))
+}
+
+// apiOptions returns optFns, along with the options that instrument an S3
+// call if telemetry is enabled.
+func (c *Client) apiOptions(optFns ...func(*s3.Options)) []func(*s3.Options) {
+	t := c.telemetry()
+	if t == nil {
+		return optFns
+	}
+
+	return append(optFns, s3.WithAPIOptions(t.instrument))
+}
+
+// s3Call tracks the attempts of an S3 call.
+type s3Call struct {
+	attempts int64
+}
+
+type s3CallKey struct{}
+
+// instrument adds middleware to an S3 call's stack, that traces the call
+// and records its metrics.
+func (t *telemetry) instrument(stack *middleware.Stack) error {
+	call := middleware.InitializeMiddlewareFunc("PomdbTelemetry", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		start := time.Now()
+		name := awsmiddleware.GetOperationName(ctx)
+		attrs := withAttributes(operationAttributes(ctx), attribute.String("rpc.method", name))
+
+		var span trace.Span
+		if t.tracer != nil {
+			ctx, span = t.tracer.Start(ctx, "S3."+name,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(withAttributes(attrs,
+					attribute.String("rpc.system", "aws-api"),
+					attribute.String("rpc.service", "S3"))...))
+		}
+
+		state := &s3Call{}
+		ctx = context.WithValue(ctx, s3CallKey{}, state)
+
+		out, md, err := next.HandleInitialize(ctx, in)
+
+		if t.requestDuration != nil {
+			t.requestDuration.Record(ctx, time.Since(start).Seconds(),
+				metric.WithAttributes(withAttributes(attrs, attribute.Bool("pomdb.error", err != nil))...))
+		}
+
+		if t.retries != nil && state.attempts > 1 {
+			t.retries.Add(ctx, state.attempts-1, metric.WithAttributes(attrs...))
+		}
+
+		if t.conflicts != nil && err != nil && isPreconditionFailed(err) {
+			t.conflicts.Add(ctx, 1, metric.WithAttributes(withAttributes(operationAttributes(ctx), attribute.String("pomdb.conflict", "precondition"))...))
+		}
+
+		if span != nil {
+			span.SetAttributes(attribute.Int64("pomdb.s3.attempts", state.attempts))
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+
+		return out, md, err
+	})
+
+	// The deserialize step runs once per attempt
+	attempt := middleware.DeserializeMiddlewareFunc("PomdbTelemetryAttempt", func(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (middleware.DeserializeOutput, middleware.Metadata, error) {
+		if state, ok := ctx.Value(s3CallKey{}).(*s3Call); ok {
+			state.attempts++
+		}
+
+		out, md, err := next.HandleDeserialize(ctx, in)
+
+		attrs := withAttributes(operationAttributes(ctx), attribute.String("rpc.method", awsmiddleware.GetOperationName(ctx)))
+
+		if t.requests != nil {
+			t.requests.Add(ctx, 1, metric.WithAttributes(attrs...))
+		}
+
+		if t.bytes != nil {
+			if req, ok := in.Request.(*smithyhttp.Request); ok && req.ContentLength > 0 {
+				t.bytes.Add(ctx, req.ContentLength, metric.WithAttributes(withAttributes(attrs, attribute.String("network.io.direction", "transmit"))...))
+			}
+			if res, ok := out.RawResponse.(*smithyhttp.Response); ok && res.ContentLength > 0 {
+				t.bytes.Add(ctx, res.ContentLength, metric.WithAttributes(withAttributes(attrs, attribute.String("network.io.direction", "receive"))...))
+			}
+		}
+
+		return out, md, err
+	})
+
+	if err := stack.Initialize.Add(call, middleware.After); err != nil {
+		return err
+	}
+
+	return stack.Deserialize.Add(attempt, middleware.Before)
+}
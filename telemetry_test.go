@@ -0,0 +1,191 @@
+package pomdb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pomdb/pomdb-go"
+	"github.com/pomdb/pomdb-go/local"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type account struct {
+	pomdb.Model
+	Email string `json:"email" pomdb:"index,unique"`
+}
+
+// newTestClient returns a client backed by a local bucket.
+func newTestClient(t *testing.T) *pomdb.Client {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := local.CreateBucket(dir, "pomdb"); err != nil {
+		t.Fatal(err)
+	}
+
+	return &pomdb.Client{
+		Service: local.NewService(dir),
+		Bucket:  "pomdb",
+		Region:  "us-east-1",
+	}
+}
+
+func TestTelemetrySpans(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+
+	c := newTestClient(t)
+	c.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+
+	if _, err := c.Create(&account{Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exp.GetSpans()
+
+	var op *tracetest.SpanStub
+	for i := range spans {
+		if spans[i].Name == "pomdb.Create" {
+			op = &spans[i]
+		}
+	}
+	if op == nil {
+		t.Fatalf("no pomdb.Create span in %d spans", len(spans))
+	}
+
+	if v := attr(op.Attributes, "pomdb.collection"); v != "accounts" {
+		t.Errorf("pomdb.collection = %q, want accounts", v)
+	}
+
+	calls := 0
+	for _, s := range spans {
+		if s.Parent.SpanID() != op.SpanContext.SpanID() {
+			continue
+		}
+
+		calls++
+		if v := attr(s.Attributes, "rpc.service"); v != "S3" {
+			t.Errorf("%s: rpc.service = %q, want S3", s.Name, v)
+		}
+	}
+
+	if calls == 0 {
+		t.Error("pomdb.Create has no S3 child spans")
+	}
+}
+
+func TestTelemetryMetrics(t *testing.T) {
+	rd := metric.NewManualReader()
+
+	c := newTestClient(t)
+	c.MeterProvider = metric.NewMeterProvider(metric.WithReader(rd))
+
+	if _, err := c.Create(&account{Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Create(&account{Email: "a@example.com"}); err == nil {
+		t.Fatal("Create with a duplicate unique value succeeded")
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := rd.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := sum(rm, "pomdb.s3.requests", "pomdb.operation", "Create"); n == 0 {
+		t.Error("no S3 requests recorded for Create")
+	}
+
+	if n := sum(rm, "pomdb.s3.bytes", "network.io.direction", "transmit"); n == 0 {
+		t.Error("no bytes sent recorded")
+	}
+
+	if n := sum(rm, "pomdb.conflicts", "pomdb.conflict", "unique"); n != 1 {
+		t.Errorf("unique conflicts = %d, want 1", n)
+	}
+
+	if n := count(rm, "pomdb.operation.duration", "pomdb.collection", "accounts"); n != 2 {
+		t.Errorf("operation durations = %d, want 2", n)
+	}
+}
+
+func TestTelemetrySharedWithContext(t *testing.T) {
+	rd := metric.NewManualReader()
+
+	c := newTestClient(t)
+	c.MeterProvider = metric.NewMeterProvider(metric.WithReader(rd))
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := c.WithContext(ctx).Create(&account{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := rd.Collect(ctx, &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(rm, "pomdb.operation.duration", "pomdb.operation", "Create"); n != 3 {
+		t.Errorf("operation durations = %d, want 3", n)
+	}
+}
+
+// attr returns the string value of the attribute with the given key.
+func attr(attrs []attribute.KeyValue, key string) string {
+	for _, kv := range attrs {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+
+	return ""
+}
+
+// sum adds up the data points of a counter with the given attribute.
+func sum(rm metricdata.ResourceMetrics, name, key, value string) int64 {
+	var n int64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			d, ok := m.Data.(metricdata.Sum[int64])
+			if !ok || m.Name != name {
+				continue
+			}
+
+			for _, p := range d.DataPoints {
+				if v, ok := p.Attributes.Value(attribute.Key(key)); ok && v.Emit() == value {
+					n += p.Value
+				}
+			}
+		}
+	}
+
+	return n
+}
+
+// count adds up the number of values recorded by a histogram with the given
+// attribute.
+func count(rm metricdata.ResourceMetrics, name, key, value string) uint64 {
+	var n uint64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			d, ok := m.Data.(metricdata.Histogram[float64])
+			if !ok || m.Name != name {
+				continue
+			}
+
+			for _, p := range d.DataPoints {
+				if v, ok := p.Attributes.Value(attribute.Key(key)); ok && v.Emit() == value {
+					n += p.Count
+				}
+			}
+		}
+	}
+
+	return n
+}
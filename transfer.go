@@ -0,0 +1,461 @@
+package pomdb
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ExportOptions configures Export.
+type ExportOptions struct {
+	// WithTrashed includes soft-deleted records.
+	WithTrashed bool
+
+	// WithMetadata includes the stored metadata of each record.
+	WithMetadata bool
+}
+
+// ExportRecord is a line of an export. Records are serialized as json,
+// whichever codec they are stored with, and exports hold them decrypted.
+// The first line of an export holds the collection's manifest instead, if
+// it has one.
+type ExportRecord struct {
+	Manifest *CollectionManifest `json:"manifest,omitempty"`
+	Record   json.RawMessage     `json:"record,omitempty"`
+	Trashed  bool                `json:"trashed,omitempty"`
+	Metadata *ExportMetadata     `json:"metadata,omitempty"`
+}
+
+// ExportMetadata is the stored metadata of an exported record.
+type ExportMetadata struct {
+	LastModified Timestamp   `json:"last_modified"`
+	ETag         string      `json:"etag"`
+	ContentType  string      `json:"content_type"`
+	Compression  Compression `json:"compression,omitempty"`
+
+	// Tags are the object's user-defined metadata, other than the metadata
+	// PomDB stores with records. Import restores them.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// ImportConflictPolicy selects how Import treats records that conflict with
+// stored ones.
+type ImportConflictPolicy int
+
+const (
+	// ImportSkip skips conflicting records, and reports them.
+	ImportSkip ImportConflictPolicy = iota
+
+	// ImportOverwrite replaces stored records with the same ID. Records
+	// whose unique values are held by other records are still skipped.
+	ImportOverwrite
+
+	// ImportFail stops the import at the first conflicting record, with
+	// ErrRecordExists or an ErrUniqueViolation.
+	ImportFail
+)
+
+// ImportOptions configures Import.
+type ImportOptions struct {
+	// DryRun checks the records without writing them.
+	DryRun bool
+
+	// OnConflict selects how conflicting records are treated.
+	OnConflict ImportConflictPolicy
+}
+
+// ImportConflict is a record Import did not write.
+type ImportConflict struct {
+	Line   int
+	ID     string
+	Reason string
+}
+
+// ImportReport summarizes the changes made by Import, or those it would
+// make in a dry run.
+type ImportReport struct {
+	Created   int
+	Updated   int
+	Skipped   int
+	Conflicts []ImportConflict
+}
+
+// Export writes the records of a collection to w as JSON Lines, one
+// ExportRecord per line, in order of ID, and returns the number of records
+// written. Expired records are not exported.
+func (c *Client) Export(ctx context.Context, model interface{}, w io.Writer, opts ExportOptions) (int, error) {
+	c = c.WithContext(ctx)
+
+	// Dereference the input
+	rv, err := dereferenceStruct(model)
+	if err != nil {
+		return 0, err
+	}
+
+	// Build the struct cache
+	ca := NewModelCache(rv)
+
+	pfx := ca.Collection + "/"
+
+	lst := &s3.ListObjectsV2Input{
+		Bucket:    &c.Bucket,
+		Prefix:    &pfx,
+		Delimiter: aws.String("/"),
+	}
+
+	enc := json.NewEncoder(w)
+
+	// Describe the collection, so the export can be imported elsewhere
+	m, err := c.getManifest(ca.Collection)
+	if err != nil {
+		return 0, err
+	}
+
+	if m != nil {
+		if err := enc.Encode(&ExportRecord{Manifest: m}); err != nil {
+			return 0, err
+		}
+	}
+
+	n := 0
+	pgr := s3.NewListObjectsV2Paginator(c.Service, lst)
+	for pgr.HasMorePages() {
+		pge, err := pgr.NextPage(c.context(), c.apiOptions()...)
+		if err != nil {
+			return n, err
+		}
+
+		// Records are read concurrently, and written in order
+		lines := make([]*ExportRecord, len(pge.Contents))
+		err = c.forEach(len(pge.Contents), func(i int) error {
+			line, err := c.exportRecord(ca, *pge.Contents[i].Key, opts)
+			lines[i] = line
+			return err
+		})
+		if err != nil {
+			return n, fmt.Errorf("[Error] Export: %w", err)
+		}
+
+		for _, line := range lines {
+			if line == nil {
+				continue
+			}
+
+			if err := enc.Encode(line); err != nil {
+				return n, err
+			}
+
+			n++
+		}
+	}
+
+	c.logger().Info("exported collection", "collection", ca.Collection, "records", n)
+
+	return n, nil
+}
+
+// exportRecord reads the record stored at key as a line of an export, or
+// returns nil if the record is not exported.
+func (c *Client) exportRecord(ca *ModelCache, key string, opts ExportOptions) (*ExportRecord, error) {
+	get := &s3.GetObjectInput{
+		Bucket: &c.Bucket,
+		Key:    &key,
+	}
+
+	var noSuchKey *types.NoSuchKey
+	doc, err := c.Service.GetObject(c.context(), get, c.apiOptions()...)
+	if err != nil && errors.As(err, &noSuchKey) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	meta := doc.Metadata
+	comp := recordCompression(doc)
+
+	model, err := c.decodeRecord(ca, key, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.isExpired(ca.Collection, model) {
+		return nil, nil
+	}
+
+	mc := NewModelCache(reflect.ValueOf(model).Elem())
+	trashed, err := c.isTrashed(mc)
+	if err != nil {
+		return nil, err
+	}
+
+	if trashed && !opts.WithTrashed {
+		return nil, nil
+	}
+
+	record, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+
+	line := &ExportRecord{Record: record, Trashed: trashed}
+	if opts.WithMetadata {
+		line.Metadata = &ExportMetadata{
+			LastModified: Timestamp(aws.ToTime(doc.LastModified)),
+			ETag:         aws.ToString(doc.ETag),
+			ContentType:  meta[metaContentType],
+			Compression:  comp,
+		}
+
+		for k, v := range meta {
+			if strings.HasPrefix(k, "pomdb-") {
+				continue
+			}
+
+			if line.Metadata.Tags == nil {
+				line.Metadata.Tags = make(map[string]string)
+			}
+			line.Metadata.Tags[k] = v
+		}
+	}
+
+	return line, nil
+}
+
+// Import recreates the records of an export in a collection, keeping their
+// IDs, timestamps and soft-deleted state, and writes their index items.
+// Records are written with the collection's codec, compression and
+// encryption. A record conflicts with the stored ones if a record with its
+// ID exists, or another record holds one of its unique values. Lines that
+// hold a record without an export envelope are imported as live records.
+// Records of the export are checked against each other too, so a record is
+// skipped if an earlier live record of the export holds one of its unique
+// values, in dry runs as well.
+func (c *Client) Import(ctx context.Context, model interface{}, r io.Reader, opts ImportOptions) (*ImportReport, error) {
+	c = c.WithContext(ctx)
+
+	// Dereference the input
+	rv, err := dereferenceStruct(model)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the struct cache
+	ca := NewModelCache(rv)
+
+	report := &ImportReport{}
+
+	// Unique values of the records imported so far, by field and value
+	seen := make(map[string]string)
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 64<<20)
+
+	for line := 1; sc.Scan(); line++ {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		if len(strings.TrimSpace(sc.Text())) == 0 {
+			continue
+		}
+
+		if err := c.importRecord(ca, sc.Bytes(), line, opts, report, seen); err != nil {
+			return report, fmt.Errorf("[Error] Import: line %d: %w", line, err)
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return report, fmt.Errorf("[Error] Import: %w", err)
+	}
+
+	c.logger().Info("imported collection", "collection", ca.Collection, "created", report.Created, "updated", report.Updated, "skipped", report.Skipped, "dry_run", opts.DryRun)
+
+	return report, nil
+}
+
+// importRecord imports a line of an export. seen holds the IDs of the live
+// records already imported, by unique field and value.
+func (c *Client) importRecord(ca *ModelCache, b []byte, line int, opts ImportOptions, report *ImportReport, seen map[string]string) error {
+	var entry ExportRecord
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return err
+	}
+
+	// Manifests are written by registering the collection
+	if entry.Manifest != nil {
+		return nil
+	}
+
+	if entry.Record == nil {
+		entry = ExportRecord{Record: b}
+	}
+
+	model := reflect.New(reflect.TypeOf(ca.Reference).Elem()).Interface()
+	if err := json.Unmarshal(entry.Record, model); err != nil {
+		return err
+	}
+
+	mc := NewModelCache(reflect.ValueOf(model).Elem())
+
+	// Records without an ID are created as new records
+	if mc.ModelID.Interface().(ULID).IsZero() {
+		mc.SetManagedFields()
+		mc = NewModelCache(reflect.ValueOf(model).Elem())
+	}
+
+	id := mc.GetModelID()
+
+	conflict := func(err error) error {
+		if opts.OnConflict == ImportFail {
+			return fmt.Errorf("record %s: %w", id, err)
+		}
+
+		report.Skipped++
+		report.Conflicts = append(report.Conflicts, ImportConflict{Line: line, ID: id, Reason: err.Error()})
+		return nil
+	}
+
+	// Check for a stored record with the same ID
+	prev, _, err := c.getRecord(ca, ca.Collection+"/"+id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	exists := err == nil
+	if exists && opts.OnConflict != ImportOverwrite {
+		return conflict(ErrRecordExists)
+	}
+
+	// Check for unique values held by other records
+	if err := c.CheckIndexExists(mc); err != nil {
+		var uv *ErrUniqueViolation
+		if errors.As(err, &uv) {
+			return conflict(uv)
+		}
+		return err
+	}
+
+	// Check for unique values held by earlier records of the export, which
+	// are not stored yet in a dry run
+	var uniques []string
+	for _, index := range mc.IndexFields {
+		if index.IndexType != UniqueIndex || index.CurrentValue == "" {
+			continue
+		}
+
+		k := index.FieldName + "/" + index.CurrentValue
+		if owner, ok := seen[k]; ok && owner != id {
+			c.recordConflict("unique")
+			return conflict(&ErrUniqueViolation{Field: index.FieldName, Value: index.CurrentValue})
+		}
+
+		uniques = append(uniques, k)
+	}
+
+	// Soft-deleted records do not hold their unique values
+	if !entry.Trashed {
+		for _, k := range uniques {
+			seen[k] = id
+		}
+	}
+
+	if exists {
+		report.Updated++
+	} else {
+		report.Created++
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+
+	// Remove the index items of the record being replaced
+	if exists {
+		pc := NewModelCache(reflect.ValueOf(prev).Elem())
+		trashed, err := c.isTrashed(pc)
+		if err != nil {
+			return err
+		}
+
+		if trashed {
+			err = c.DeleteTrashItems(pc)
+		} else {
+			err = c.DeleteIndexItems(pc)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Restore the record's user-defined metadata
+	var tags []func(*s3.Options)
+	if entry.Metadata != nil {
+		tags = append(tags, withMetadata(entry.Metadata.Tags))
+	}
+
+	if _, err := c.putRecord(mc, model, tags...); err != nil {
+		return err
+	}
+
+	if err := c.CreateIndexItems(mc); err != nil {
+		return err
+	}
+
+	op := ChangeCreate
+	if exists {
+		op = ChangeUpdate
+	}
+
+	marker := &s3.PutObjectInput{
+		Bucket: &c.Bucket,
+		Key:    aws.String(encodeTrashMarker(ca.Collection, id)),
+	}
+
+	if !entry.Trashed {
+		if exists {
+			// The replaced record may have been soft-deleted
+			del := &s3.DeleteObjectInput{
+				Bucket: marker.Bucket,
+				Key:    marker.Key,
+			}
+
+			if _, err := c.Service.DeleteObject(c.context(), del, c.apiOptions()...); err != nil {
+				return err
+			}
+		}
+
+		return c.appendChange(mc, op, model)
+	}
+
+	// Move the index items of soft-deleted records to the trash
+	if mc.DeletedAt != nil && !mc.IsDeleted() {
+		mc.SetDeletedAt()
+		if _, err := c.putRecord(mc, model, tags...); err != nil {
+			return err
+		}
+	}
+
+	if err := c.TrashIndexItems(mc); err != nil {
+		return err
+	}
+
+	if _, err := c.Service.PutObject(c.context(), marker, c.apiOptions()...); err != nil {
+		return err
+	}
+
+	// Soft-deleted records are logged as created or updated, then deleted
+	if err := c.appendChange(mc, op, model); err != nil {
+		return err
+	}
+
+	return c.appendChange(mc, ChangeDelete, model)
+}
@@ -0,0 +1,124 @@
+package pomdb
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ttlTag is the object tag records of collections with a time-to-live are
+// written with, so lifecycle rules can be scoped to records.
+const ttlTag = "pomdb-ttl"
+
+// Sweep purges the expired records of a collection, along with their
+// indexes, and returns the number of records purged.
+func (c *Client) Sweep(ctx context.Context, model interface{}) (int, error) {
+	c = c.WithContext(ctx)
+
+	// Dereference the input
+	rv, err := dereferenceStruct(model)
+	if err != nil {
+		return 0, err
+	}
+
+	// Build the struct cache
+	ca := NewModelCache(rv)
+
+	// Set record prefix path
+	pfx := ca.Collection + "/"
+
+	lst := &s3.ListObjectsV2Input{
+		Bucket:    &c.Bucket,
+		Prefix:    &pfx,
+		Delimiter: aws.String("/"),
+	}
+
+	purged := 0
+	pgr := s3.NewListObjectsV2Paginator(c.Service, lst)
+	for pgr.HasMorePages() {
+		pge, err := pgr.NextPage(ctx, c.apiOptions()...)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, obj := range pge.Contents {
+			if err := ctx.Err(); err != nil {
+				return purged, err
+			}
+
+			if strings.HasSuffix(*obj.Key, "/") {
+				continue
+			}
+
+			doc, _, err := c.getRecord(ca, *obj.Key)
+			if err != nil {
+				return purged, err
+			}
+
+			if !c.isExpired(ca.Collection, doc) {
+				continue
+			}
+
+			if _, err := c.Purge(doc); err != nil {
+				return purged, err
+			}
+
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// LifecycleRule returns an S3 lifecycle rule that expires the records of a
+// collection with a time-to-live. Records of such collections are tagged
+// when they are written, and the rule only applies to tagged objects under
+// the collection's prefix, so index items, versions, trash markers and
+// changelog entries are kept. The rule is a backstop for Sweep: it works at
+// a resolution of days, from when each record was last written, and does
+// not apply to expiry set through a ttl field. The index items of the
+// records it expires are left behind, and are removed by Verify with
+// repair.
+func (c *Client) LifecycleRule(model interface{}) (*types.LifecycleRule, error) {
+	// Dereference the input
+	rv, err := dereferenceStruct(model)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the struct cache
+	ca := NewModelCache(rv)
+
+	ttl := c.options(ca.Collection).TTL
+	if ttl <= 0 {
+		return nil, fmt.Errorf("[Error] LifecycleRule: %w: collection %s has no time-to-live", ErrInvalidModel, ca.Collection)
+	}
+
+	days := int32(math.Ceil(ttl.Hours() / 24))
+
+	return &types.LifecycleRule{
+		ID:     aws.String("pomdb-ttl-" + ca.Collection),
+		Status: types.ExpirationStatusEnabled,
+		Filter: &types.LifecycleRuleFilterMemberAnd{
+			Value: types.LifecycleRuleAndOperator{
+				Prefix: aws.String(ca.Collection + "/"),
+				Tags:   []types.Tag{{Key: aws.String(ttlTag), Value: aws.String("true")}},
+			},
+		},
+		Expiration: &types.LifecycleExpiration{
+			Days: aws.Int32(days),
+		},
+	}, nil
+}
+
+// isExpired reports whether a decoded record of the collection has expired.
+func (c *Client) isExpired(collection string, doc interface{}) bool {
+	ca := NewModelCache(reflect.ValueOf(doc).Elem())
+	return ca.IsExpired(c.options(collection).TTL)
+}
@@ -0,0 +1,90 @@
+package pomdb_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/pomdb/pomdb-go"
+)
+
+type session struct {
+	pomdb.Model
+	Token string `json:"token" pomdb:"index,unique"`
+}
+
+func TestLifecycleRule(t *testing.T) {
+	c := newTestClient(t)
+	if err := c.Register(&session{}, pomdb.CollectionOptions{TTL: 36 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	rule, err := c.LifecycleRule(&session{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if aws.ToString(rule.ID) != "pomdb-ttl-sessions" || rule.Status != types.ExpirationStatusEnabled {
+		t.Errorf("rule = %s, %s", aws.ToString(rule.ID), rule.Status)
+	}
+
+	if days := aws.ToInt32(rule.Expiration.Days); days != 2 {
+		t.Errorf("expiration = %d days, want 2", days)
+	}
+
+	// The rule only applies to tagged records of the collection
+	and, ok := rule.Filter.(*types.LifecycleRuleFilterMemberAnd)
+	if !ok {
+		t.Fatalf("filter = %T, want an and filter", rule.Filter)
+	}
+
+	if p := aws.ToString(and.Value.Prefix); p != "sessions/" {
+		t.Errorf("prefix = %s, want sessions/", p)
+	}
+
+	tags := and.Value.Tags
+	if len(tags) != 1 || aws.ToString(tags[0].Key) != "pomdb-ttl" || aws.ToString(tags[0].Value) != "true" {
+		t.Errorf("tags = %+v, want pomdb-ttl=true", tags)
+	}
+
+	if _, err := c.LifecycleRule(&account{}); !errors.Is(err, pomdb.ErrInvalidModel) {
+		t.Errorf("rule of a collection without a time-to-live: %v", err)
+	}
+}
+
+func TestLifecycleRuleTagsRecords(t *testing.T) {
+	c := newTestClient(t)
+	if err := c.Register(&session{}, pomdb.CollectionOptions{TTL: time.Hour, History: true, Changelog: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Record the keys written with tags
+	var mu sync.Mutex
+	tagged := make(map[string]string)
+	c.Service = s3.New(c.Service.Options(), s3.WithAPIOptions(func(st *middleware.Stack) error {
+		return st.Initialize.Add(middleware.InitializeMiddlewareFunc("tags", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			if put, ok := in.Parameters.(*s3.PutObjectInput); ok && put.Tagging != nil {
+				mu.Lock()
+				tagged[*put.Key] = *put.Tagging
+				mu.Unlock()
+			}
+
+			return next.HandleInitialize(ctx, in)
+		}), middleware.After)
+	}))
+
+	s := &session{Token: "abc"}
+	if _, err := c.Create(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tagged) != 1 || tagged["sessions/"+s.ID.String()] != "pomdb-ttl=true" {
+		t.Errorf("tagged objects = %v, want only the record", tagged)
+	}
+}
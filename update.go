@@ -1,9 +1,7 @@
 package pomdb
 
 import (
-	"bytes"
-	"context"
-	"encoding/json"
+	"fmt"
 	"reflect"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -11,6 +9,13 @@ import (
 
 // Update updates a record in the database.
 func (c *Client) Update(i interface{}) (*string, error) {
+	return c.invokeETag(&Operation{Name: "Update", Model: i}, func(c *Client, op *Operation) (interface{}, error) {
+		return c.update(op.Model)
+	})
+}
+
+// update implements Update.
+func (c *Client) update(i interface{}) (*string, error) {
 	// Dereference the input
 	rv, err := dereferenceStruct(i)
 	if err != nil {
@@ -29,56 +34,73 @@ func (c *Client) Update(i interface{}) (*string, error) {
 	// Set the record's key
 	key := co + "/" + id
 
-	// Use s3 to get the record
-	get := &s3.GetObjectInput{
-		Bucket: &c.Bucket,
-		Key:    &key,
+	// Get the current record
+	model, _, err := c.getRecord(ca, key)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get the record's data
-	doc, err := c.Service.GetObject(context.TODO(), get)
-	if err != nil {
+	return c.updateRecord(ca, i, model)
+}
+
+// updateRecord replaces the data of an existing record, moving any index
+// items whose values differ from the previous version of the record.
+func (c *Client) updateRecord(ca *ModelCache, i interface{}, prev interface{}, optFns ...func(*s3.Options)) (*string, error) {
+	if err := runHook(c.context(), i, beforeUpdate); err != nil {
+		return nil, err
+	}
+
+	// Rebuild the struct cache, as the hook may change indexed fields
+	ca = NewModelCache(reflect.ValueOf(i).Elem())
+
+	if err := Validate(i); err != nil {
 		return nil, err
 	}
 
-	// Unmarshal the record
-	elem := reflect.TypeOf(ca.Reference).Elem()
-	model := reflect.New(elem).Interface()
-	if err := json.NewDecoder(doc.Body).Decode(&model); err != nil {
+	// Soft-deleted records must be restored before they are updated
+	pc := NewModelCache(reflect.ValueOf(prev).Elem())
+	trashed, err := c.isTrashed(pc)
+	if err != nil {
 		return nil, err
 	}
 
-	// Check/update indexes
-	if len(ca.IndexFields) > 0 {
-		if diff := ca.CompareIndexFields(model); diff {
-			if err := c.CheckIndexExists(ca); err != nil {
-				return nil, err
-			}
+	if trashed {
+		return nil, fmt.Errorf("[Error] Update: %w: record is soft-deleted: collection=%s, id=%s", ErrNotFound, ca.Collection, ca.GetModelID())
+	}
+
+	// Keep the record's deletion state
+	if ca.DeletedAt != nil && ca.DeletedAt.CanSet() && pc.DeletedAt != nil {
+		ca.DeletedAt.Set(*pc.DeletedAt)
+	}
 
-			if err := c.UpdateIndexItems(ca); err != nil {
-				return nil, err
-			}
+	// Check indexes
+	diff := len(ca.IndexFields) > 0 && ca.CompareIndexFields(prev)
+	if diff {
+		if err := c.CheckIndexExists(ca); err != nil {
+			return nil, err
 		}
 	}
 
-	// Encode the object
-	enc, err := json.Marshal(i)
+	// Set the record's data
+	etag, err := c.putRecord(ca, i, optFns...)
 	if err != nil {
 		return nil, err
 	}
 
-	// Set the record's data
-	put := &s3.PutObjectInput{
-		Bucket: &c.Bucket,
-		Key:    &key,
-		Body:   bytes.NewReader(enc),
+	// Update indexes
+	if diff {
+		if err := c.UpdateIndexItems(ca); err != nil {
+			return nil, err
+		}
 	}
 
-	// Set the record's etag
-	res, err := c.Service.PutObject(context.TODO(), put)
-	if err != nil {
+	if err := c.appendChange(ca, ChangeUpdate, i); err != nil {
+		return nil, err
+	}
+
+	if err := runHook(c.context(), i, afterUpdate); err != nil {
 		return nil, err
 	}
 
-	return res.ETag, nil
+	return etag, nil
 }
@@ -0,0 +1,117 @@
+package pomdb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Upsert creates a record, or replaces the existing record matching the
+// model's ID or the value of the given unique index field. The ID and
+// creation time of a replaced record are preserved.
+func (c *Client) Upsert(i interface{}, field string) (*string, error) {
+	return c.invokeETag(&Operation{Name: "Upsert", Model: i, Field: field}, func(c *Client, op *Operation) (interface{}, error) {
+		return c.upsert(op.Model, op.Field)
+	})
+}
+
+// upsert implements Upsert.
+func (c *Client) upsert(i interface{}, field string) (*string, error) {
+	// Dereference the input
+	rv, err := dereferenceStruct(i)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the struct cache
+	ca := NewModelCache(rv)
+
+	// Resolve the ID of the existing record
+	var id string
+	if field == "" || field == "id" {
+		if uid := ca.ModelID.Interface().(ULID); !uid.IsZero() {
+			id = uid.String()
+		}
+	} else {
+		id, err = c.findUniqueID(ca, field)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Create a new record when there is nothing to match
+	if id == "" {
+		ca.SetManagedFields()
+		return c.createRecord(ca, i)
+	}
+
+	uid, err := ParseULID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the existing record
+	prev, _, err := c.getRecord(ca, ca.Collection+"/"+id)
+	if err != nil && errors.Is(err, ErrNotFound) {
+		// Create the record under the resolved ID, which also reclaims any
+		// index items left behind by a previous record with that ID
+		ca.SetManagedFields()
+		ca.ModelID.Set(reflect.ValueOf(uid))
+		return c.createRecord(ca, i)
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Carry over the existing record's ID and timestamps
+	ca.CopyManagedFields(NewModelCache(reflect.ValueOf(prev).Elem()))
+
+	return c.updateRecord(ca, i, prev)
+}
+
+// findUniqueID returns the ID of the record holding the model's value for
+// the given unique index field, or an empty string if there is none.
+func (c *Client) findUniqueID(ca *ModelCache, field string) (string, error) {
+	idx := ca.GetIndexField(field)
+	if idx == nil {
+		return "", fmt.Errorf("[Error] Upsert: %w: %s", ErrIndexNotFound, field)
+	}
+
+	if idx.IndexType != UniqueIndex {
+		return "", fmt.Errorf("[Error] Upsert: %w: index field %s is not unique", ErrInvalidQuery, field)
+	}
+
+	if idx.CurrentValue == "" {
+		return "", fmt.Errorf("[Error] Upsert: %w: index field %s has no value", ErrInvalidModel, field)
+	}
+
+	// Set index pfx path
+	pfx, err := c.indexPrefix(ca.Collection, *idx, idx.CurrentValue)
+	if err != nil {
+		return "", err
+	}
+
+	// The trailing slash keeps values that extend this one from matching
+	lst := &s3.ListObjectsV2Input{
+		Bucket: &c.Bucket,
+		Prefix: aws.String(pfx + "/"),
+	}
+
+	res, err := c.Service.ListObjectsV2(c.context(), lst, c.apiOptions()...)
+	if err != nil {
+		return "", err
+	}
+
+	if len(res.Contents) == 0 {
+		return "", nil
+	}
+
+	if len(res.Contents) > 1 {
+		return "", fmt.Errorf("[Error] Upsert: %w: collection=%s, field=%s", ErrMultipleRecords, ca.Collection, field)
+	}
+
+	return strings.TrimPrefix(*res.Contents[0].Key, pfx+"/"), nil
+}
@@ -7,18 +7,19 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 )
 
 func dereferenceStruct(i interface{}) (reflect.Value, error) {
 	rv := reflect.ValueOf(i)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
-		return reflect.Value{}, errors.New("[Error] DereferenceStruct: model must be a non-nil pointer")
+		return reflect.Value{}, fmt.Errorf("[Error] DereferenceStruct: %w: model must be a non-nil pointer", ErrInvalidModel)
 	}
 
 	elem := rv.Elem()
 	if elem.Kind() != reflect.Struct {
-		return reflect.Value{}, errors.New("[Error] DereferenceStruct: model must be a pointer to a struct")
+		return reflect.Value{}, fmt.Errorf("[Error] DereferenceStruct: %w: model must be a pointer to a struct", ErrInvalidModel)
 	}
 
 	if hasPomdbModel(elem) {
@@ -58,8 +59,9 @@ func checkRootLevelFields(v reflect.Value, rootTags map[string]bool) error {
 		tagParts := strings.Split(tagValue, ",")
 
 		for _, tagPart := range tagParts {
+			tagPart = strings.TrimSpace(tagPart)
 			if rootTags[tagPart] {
-				if tagPart == "id" && fieldType.Type.Name() == "ObjectID" {
+				if tagPart == "id" && fieldType.Type == reflect.TypeOf(ULID{}) {
 					idFieldFound = true
 				}
 				if err := checkSettable(field, fieldType.Name); err != nil {
@@ -70,7 +72,7 @@ func checkRootLevelFields(v reflect.Value, rootTags map[string]bool) error {
 	}
 
 	if !idFieldFound {
-		return errors.New("[Error] CheckRootLevelFields: model must have an 'id' field of type 'ObjectID'")
+		return fmt.Errorf("[Error] CheckRootLevelFields: %w: model must have an 'id' field of type 'ULID'", ErrInvalidModel)
 	}
 
 	return nil
@@ -79,10 +81,10 @@ func checkRootLevelFields(v reflect.Value, rootTags map[string]bool) error {
 func checkSettable(field reflect.Value, fieldName string) error {
 	if !field.CanSet() {
 		if isExported := unicode.IsUpper([]rune(fieldName)[0]); !isExported {
-			return fmt.Errorf("[Error] CheckSettable: field '%s' is not exported and therefore not settable", fieldName)
+			return fmt.Errorf("[Error] CheckSettable: %w: field '%s' is not exported and therefore not settable", ErrInvalidModel, fieldName)
 		}
 		if field.Kind() == reflect.Ptr && field.IsNil() {
-			return fmt.Errorf("[Error] CheckSettable: field '%s' is a nil pointer and not settable", fieldName)
+			return fmt.Errorf("[Error] CheckSettable: %w: field '%s' is a nil pointer and not settable", ErrInvalidModel, fieldName)
 		}
 	}
 	return nil
@@ -118,13 +120,23 @@ func tagContains(tagValue string, keys []string) bool {
 	return true
 }
 
+// jsonName returns the json name of a struct field.
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return f.Name
+	}
+
+	return name
+}
+
 // encodeIndexPrefix returns the index path for the given field name and value.
 func encodeIndexPrefix(collection, field string, value any, idxtype IndexType) (string, error) {
 	// Encode the index field value in base64
 	code := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%v", value)))
 
 	if len(code) > 1024 {
-		return "", fmt.Errorf("[Error] encodeIndexPrefix: index %s with value %s is > 1024 bytes", field, value)
+		return "", fmt.Errorf("[Error] encodeIndexPrefix: index %s with value %v is > 1024 bytes", field, value)
 	}
 
 	switch idxtype {
@@ -139,6 +151,17 @@ func encodeIndexPrefix(collection, field string, value any, idxtype IndexType) (
 	}
 }
 
+// encodeTrashKey returns the key a record's index item is moved to while
+// the record is soft-deleted.
+func encodeTrashKey(key string) string {
+	return strings.Replace(key, "/indexes/", "/trash/", 1)
+}
+
+// encodeTrashMarker returns the key that marks a record as soft-deleted.
+func encodeTrashMarker(collection, id string) string {
+	return collection + "/trash/" + id
+}
+
 // encodeQueryPrefix returns the index path for the given field name.
 func encodeQueryPrefix(collection, field string, idxtype IndexType) (string, error) {
 	switch idxtype {
@@ -227,3 +250,31 @@ func stringifyFieldValue(field reflect.Value, ftype reflect.StructField) (string
 
 	return "", fmt.Errorf("unsupported field type %s", ftype.Type)
 }
+
+// encodeVersionKey returns the key of a record version stored at time t.
+// Version timestamps are zero-padded nanoseconds, so they sort by time.
+func encodeVersionKey(collection, id string, t time.Time) string {
+	return collection + "/versions/" + id + "/" + fmt.Sprintf("%019d", t.UnixNano())
+}
+
+// decodeVersionKey returns the time a record version was stored.
+func decodeVersionKey(key string) (Timestamp, error) {
+	ns, err := strconv.ParseInt(key[strings.LastIndex(key, "/")+1:], 10, 64)
+	if err != nil || ns < 0 {
+		return Timestamp{}, fmt.Errorf("[Error] decodeVersionKey: invalid version key %s", key)
+	}
+
+	return Timestamp(time.Unix(0, ns)), nil
+}
+
+// tagValue returns the value of a key-value pair in the tag string.
+func tagValue(tagValue, key string) (string, bool) {
+	for _, tag := range strings.Split(tagValue, ",") {
+		k, v, found := strings.Cut(strings.TrimSpace(tag), "=")
+		if found && k == key {
+			return v, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,202 @@
+package pomdb
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldError describes a field that failed a validation rule.
+type FieldError struct {
+	Field   string
+	Rule    string
+	Message string
+}
+
+// ValidationError lists every field of a model that failed validation.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for k, f := range e.Fields {
+		msgs[k] = f.Field + " " + f.Message
+	}
+
+	return "[Error] Validate: " + strings.Join(msgs, "; ")
+}
+
+// Is reports whether target is ErrInvalidModel, which a failed validation
+// is a case of.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidModel
+}
+
+// patterns caches compiled regex rules by pattern.
+var patterns sync.Map
+
+// Validate checks a model against the rules in its pomdb tags, and returns a
+// *ValidationError listing every failing field. The supported rules are:
+//
+//   - required: the field must not be its zero value
+//   - min=n, max=n: bounds on the length of strings, slices and maps, or on
+//     the value of numbers
+//   - regex=pattern: strings must match the pattern, which cannot contain
+//     commas
+//   - enum=a|b|c: the field must be one of the given values
+//
+// Length, regex, and enum rules are skipped for empty values, so they
+// should be combined with required to reject them.
+func Validate(i interface{}) error {
+	// Dereference the input
+	rv, err := dereferenceStruct(i)
+	if err != nil {
+		return err
+	}
+
+	verr := &ValidationError{}
+
+	for j := 0; j < rv.NumField(); j++ {
+		field := rv.Field(j)
+		fpntr := rv.Type().Field(j)
+		pmtag := fpntr.Tag.Get("pomdb")
+
+		if fpntr.Anonymous || pmtag == "" {
+			continue
+		}
+
+		name := strings.Split(fpntr.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = fpntr.Name
+		}
+
+		for _, fe := range validateField(field, pmtag) {
+			fe.Field = name
+			verr.Fields = append(verr.Fields, fe)
+		}
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+
+	return nil
+}
+
+// validateField returns the rules in the tag that the field fails.
+func validateField(field reflect.Value, pmtag string) []FieldError {
+	var errs []FieldError
+
+	if field.IsZero() {
+		if tagContains(pmtag, []string{"required"}) {
+			errs = append(errs, FieldError{Rule: "required", Message: "is required"})
+		}
+
+		if !isNumber(field.Kind()) {
+			return errs
+		}
+	}
+
+	for _, rule := range []string{"min", "max"} {
+		arg, ok := tagValue(pmtag, rule)
+		if !ok {
+			continue
+		}
+
+		bound, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			errs = append(errs, FieldError{Rule: rule, Message: fmt.Sprintf("has an invalid %s rule %q", rule, arg)})
+			continue
+		}
+
+		size, unit, ok := measureField(field)
+		if !ok {
+			continue
+		}
+
+		if rule == "min" && size < bound {
+			errs = append(errs, FieldError{Rule: rule, Message: fmt.Sprintf("must be at least %s%s", arg, unit)})
+		}
+		if rule == "max" && size > bound {
+			errs = append(errs, FieldError{Rule: rule, Message: fmt.Sprintf("must be at most %s%s", arg, unit)})
+		}
+	}
+
+	if arg, ok := tagValue(pmtag, "regex"); ok && field.Kind() == reflect.String {
+		re, err := compilePattern(arg)
+		if err != nil {
+			errs = append(errs, FieldError{Rule: "regex", Message: fmt.Sprintf("has an invalid regex rule %q", arg)})
+		} else if !re.MatchString(field.String()) {
+			errs = append(errs, FieldError{Rule: "regex", Message: fmt.Sprintf("must match %q", arg)})
+		}
+	}
+
+	if arg, ok := tagValue(pmtag, "enum"); ok {
+		value := fmt.Sprintf("%v", field.Interface())
+
+		found := false
+		for _, opt := range strings.Split(arg, "|") {
+			if opt == value {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			errs = append(errs, FieldError{Rule: "enum", Message: fmt.Sprintf("must be one of %s", strings.ReplaceAll(arg, "|", ", "))})
+		}
+	}
+
+	return errs
+}
+
+// measureField returns the length of strings and collections, or the value
+// of numbers, for min and max rules.
+func measureField(field reflect.Value) (float64, string, bool) {
+	switch field.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(field.String())), " characters", true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(field.Len()), " items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(field.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(field.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return field.Float(), "", true
+	}
+
+	return 0, "", false
+}
+
+func isNumber(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+// compilePattern compiles a regex rule, caching the result.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns.Store(pattern, re)
+
+	return re, nil
+}
@@ -0,0 +1,159 @@
+package pomdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// IssueKind is a kind of inconsistency between records and index items.
+type IssueKind string
+
+const (
+	// IssueOrphan is an index item whose record does not exist.
+	IssueOrphan IssueKind = "orphan"
+
+	// IssueMissing is an index item a record should have, but does not.
+	IssueMissing IssueKind = "missing"
+
+	// IssueMismatch is an index item that does not match its record's
+	// value, index type or soft-deleted state.
+	IssueMismatch IssueKind = "mismatch"
+
+	// IssueDuplicate is a unique index value held by more than one live
+	// record.
+	IssueDuplicate IssueKind = "duplicate"
+
+	// IssueLegacyTrash is a record soft-deleted by an earlier version of
+	// PomDB, which tagged it instead of writing a trash marker.
+	IssueLegacyTrash IssueKind = "legacy-trash"
+)
+
+// Issue is an inconsistency found by Verify. Key is the index item the
+// issue concerns, or the index prefix of the value for duplicates, and IDs
+// are the records involved.
+type Issue struct {
+	Kind  IssueKind
+	Field string
+	Key   string
+	IDs   []string
+}
+
+// VerifyReport is the result of checking a collection's records against
+// its index items.
+type VerifyReport struct {
+	// Records is the number of records checked.
+	Records int
+
+	// Items is the number of index items checked.
+	Items int
+
+	// Issues are the inconsistencies found, ordered by key.
+	Issues []Issue
+}
+
+// OK reports whether no issues were found.
+func (r *VerifyReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Verify cross-checks the records of a collection against its index items,
+// without changing them. It reports index items whose records do not exist,
+// records missing index items, index items that do not match their records,
+// and unique values held by more than one record.
+func (c *Client) Verify(ctx context.Context, model interface{}) (*VerifyReport, error) {
+	c = c.WithContext(ctx)
+
+	// Dereference the input
+	rv, err := dereferenceStruct(model)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the struct cache
+	ca := NewModelCache(rv)
+
+	scan, err := newIndexScan(ca, nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("[Error] Verify: %w", err)
+	}
+
+	if err := c.scanCollection(scan, &rebuildCheckpoint{Phase: "records"}, nil); err != nil {
+		return nil, fmt.Errorf("[Error] Verify: %w", err)
+	}
+
+	report := &VerifyReport{
+		Records: scan.records,
+		Items:   scan.items,
+		Issues:  scan.issues,
+	}
+
+	// Duplicates are reported once per value, under the value's prefix
+	for _, conflict := range scan.sortedConflicts() {
+		index := ca.GetIndexField(conflict.Field)
+		pfx, err := c.indexPrefix(ca.Collection, *index, conflict.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Issues = append(report.Issues, Issue{Kind: IssueDuplicate, Field: conflict.Field, Key: pfx, IDs: conflict.IDs})
+	}
+
+	sort.Slice(report.Issues, func(i, j int) bool {
+		return report.Issues[i].Key < report.Issues[j].Key
+	})
+
+	c.logger().Info("verified collection", "collection", ca.Collection, "records", report.Records, "items", report.Items, "issues", len(report.Issues))
+
+	return report, nil
+}
+
+// Repair fixes the issues of a report returned by Verify, and returns the
+// number of index items written or deleted. Each issue is checked again
+// before it is fixed, so changes made since the report are not undone.
+// Duplicates are not repaired, as the records holding the value must be
+// changed first.
+func (c *Client) Repair(ctx context.Context, model interface{}, report *VerifyReport) (int, error) {
+	c = c.WithContext(ctx)
+
+	// Dereference the input
+	rv, err := dereferenceStruct(model)
+	if err != nil {
+		return 0, err
+	}
+
+	// Build the struct cache
+	ca := NewModelCache(rv)
+
+	fixed := 0
+	for _, is := range report.Issues {
+		scan := &indexScan{
+			ca:        ca,
+			fields:    map[string]bool{is.Field: true},
+			repair:    true,
+			conflicts: make(map[string]*IndexConflict),
+		}
+
+		switch is.Kind {
+		case IssueMissing:
+			err = c.scanRecord(scan, ca.Collection+"/"+is.IDs[0])
+		case IssueLegacyTrash:
+			err = c.scanRecord(scan, is.Key)
+			fixed++
+		case IssueOrphan, IssueMismatch:
+			err = c.scanItem(scan, is.Key)
+		default:
+			continue
+		}
+
+		if err != nil {
+			return fixed, fmt.Errorf("[Error] Repair: %w", err)
+		}
+
+		fixed += scan.created + scan.removed
+	}
+
+	c.logger().Info("repaired collection", "collection", ca.Collection, "fixed", fixed)
+
+	return fixed, nil
+}